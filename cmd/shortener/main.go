@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
@@ -10,15 +11,26 @@ import (
 	"path/filepath"
 	"runtime/pprof"
 	"syscall"
+	"time"
+	_ "time/tzdata"
 
 	_ "url-shortener/docs"
+	"url-shortener/internal/blocklist"
 	"url-shortener/internal/config"
 	"url-shortener/internal/flag"
+	"url-shortener/internal/geoip"
 	"url-shortener/internal/handler"
+	"url-shortener/internal/health"
 	"url-shortener/internal/logger"
+	"url-shortener/internal/metadata"
+	"url-shortener/internal/metrics"
 	"url-shortener/internal/services"
 	"url-shortener/internal/storage"
+	"url-shortener/internal/threatlist"
+	"url-shortener/internal/tracing"
 	"url-shortener/internal/transport"
+	"url-shortener/internal/unshorten"
+	"url-shortener/internal/urlnorm"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
@@ -34,14 +46,17 @@ var (
 // @description     A URL shortening service API
 
 // @host      localhost:8080
-// @BasePath  /api/v1
+// @BasePath  /
 func main() {
 	fmt.Printf("Build version: %s\nBuild date: %s\nBuild commit: %s\n", buildVersion, buildDate, buildCommit)
 
 	cfg := flag.Parse()
-	config.New(&cfg)
-
 	log := logger.New()
+	if err := config.New(&cfg); err != nil {
+		log.Error("Error reading config", "error", err)
+		os.Exit(1)
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 	defer stop()
 
@@ -51,6 +66,19 @@ func main() {
 		}
 	}()
 
+	shutdownTracing, err := tracing.Setup(ctx, cfg.TracingExporter)
+	if err != nil {
+		log.Error("Error setting up tracing", "error", err)
+	} else {
+		defer func() {
+			sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(sctx); err != nil {
+				log.Error("Error flushing trace spans", "error", err)
+			}
+		}()
+	}
+
 	if err := os.MkdirAll("profiles", 0755); err != nil {
 		log.Error("Failed to create profiles directory", "error", err)
 	}
@@ -73,6 +101,73 @@ func main() {
 	defer store.DB.Close()
 
 	s := services.New(ctx, log, store)
+	s.Normalize = urlnorm.Options{StripTracking: cfg.StripTracking}
+
+	if cfg.GeoIPPath != "" {
+		geo, err := geoip.Open(cfg.GeoIPPath)
+		if err != nil {
+			log.Error("Error opening GeoIP database", "error", err)
+		} else {
+			defer geo.Close()
+			s.Geo = geo
+			go reloadOnHangup(ctx, log, "GeoIP database", geo)
+		}
+	}
+
+	blocked, err := blocklist.Open(cfg.BlocklistPath)
+	if err != nil {
+		log.Error("Error loading blocklist", "error", err)
+	} else {
+		s.Blocklist = blocked
+		go reloadOnHangup(ctx, log, "Blocklist", blocked)
+	}
+
+	if cfg.ThreatListPath != "" || cfg.ThreatListSource != "" {
+		threats, err := threatlist.Open(cfg.ThreatListPath)
+		if err != nil {
+			log.Error("Error loading threat lists", "error", err)
+		} else {
+			s.Threats = threats
+			go reloadOnHangup(ctx, log, "Threat lists", threats)
+			lists, err := threatlist.ParseLists(cfg.ThreatListDescriptors(threatlist.DefaultLists))
+			if err != nil {
+				log.Error("Error parsing threat lists", "error", err)
+			}
+			threats.Track(lists)
+			if cfg.ThreatListSource != "" {
+				go updateThreatLists(ctx, log, threats, threatlist.NewSource(cfg.ThreatListSource), cfg.ThreatListInterval)
+			}
+		}
+	}
+	if hosts := cfg.Shorteners(unshorten.DefaultHosts); hosts != nil {
+		s.Expander = unshorten.New(nil, hosts)
+	}
+
+	if cfg.HealthInterval > 0 {
+		s.Checker = health.New(nil, cfg.HealthConcurrency, cfg.HealthHostDelay)
+		go s.RunHealthChecks(ctx, cfg.HealthInterval)
+	}
+
+	if cfg.FetchMetadata {
+		s.Fetcher = metadata.New(nil, cfg.MetadataMaxBytes, cfg.MetadataTimeout)
+		go s.ProcessMetadata(ctx, 2)
+	}
+
+	if cfg.MetricsAddr != "" {
+		if store.DB != nil {
+			metrics.WatchDB(store.DB)
+		}
+		metrics.WatchFile(cfg.StoragePath)
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		go func() {
+			if err := http.ListenAndServe(cfg.MetricsAddr, mux); err != nil {
+				log.Error("metrics server failed", "error", err)
+			}
+		}()
+	}
+
 	h := handler.New(s, log)
 
 	t := transport.New(cfg, h, log)
@@ -90,3 +185,48 @@ func main() {
 	stop()
 	log.Info("Received shutdown signal, shutting down gracefully...")
 }
+
+// reloader is a file-backed resource that can be reloaded at runtime
+type reloader interface {
+	Reload() error
+}
+
+// reloadOnHangup reloads a file-backed resource every time the process receives SIGHUP
+func reloadOnHangup(ctx context.Context, log *slog.Logger, name string, r reloader) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := r.Reload(); err != nil {
+				log.Error("Error reloading "+name, "error", err)
+				continue
+			}
+			log.Info(name + " reloaded")
+		}
+	}
+}
+
+// updateThreatLists fetches threat list updates at startup and then once per interval
+func updateThreatLists(ctx context.Context, log *slog.Logger, threats *threatlist.List, src threatlist.Source, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := threats.Update(ctx, src); err != nil {
+			log.Error("Error updating threat lists", "error", err)
+		} else {
+			log.Info("Threat lists updated")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
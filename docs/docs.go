@@ -15,24 +15,24 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/api/shorten": {
+        "/": {
             "post": {
                 "security": [
                     {
                         "Bearer": []
                     }
                 ],
-                "description": "Creates a shortened version of a URL provided in JSON format",
+                "description": "Creates a shortened version of a provided URL\nLinks to this service and to known external shorteners are resolved to their final destination",
                 "consumes": [
-                    "application/json"
+                    "text/plain"
                 ],
                 "produces": [
-                    "application/json"
+                    "text/plain"
                 ],
                 "tags": [
                     "urls"
                 ],
-                "summary": "Shorten URL via JSON",
+                "summary": "Create shortened URL",
                 "parameters": [
                     {
                         "type": "string",
@@ -42,39 +42,157 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "description": "URL to shorten",
-                        "name": "request",
+                        "description": "Original URL to shorten",
+                        "name": "url",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.ShortenURLRequest"
+                            "type": "string"
                         }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Branded domain of the short URL",
+                        "name": "domain",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "201": {
                         "description": "Shortened URL",
                         "schema": {
-                            "$ref": "#/definitions/models.ShortenURLResponse"
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Can't read body!/URL points to this service!/Redirect chain is too long!/Couldn't encode URL!",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "URL is blocked!",
+                        "schema": {
+                            "type": "string"
                         }
                     },
                     "409": {
                         "description": "URL already exists",
                         "schema": {
-                            "$ref": "#/definitions/models.ShortenURLResponse"
+                            "type": "string"
+                        }
+                    },
+                    "413": {
+                        "description": "Request body is too large!",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/internal/blocklist": {
+            "post": {
+                "description": "Adds a domain, wildcard domain (*.example.com) or regular expression (re:...) to the blocklist\nand disables every existing link whose destination matches it",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "internal"
+                ],
+                "summary": "Block a destination",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Client IP within the trusted subnet",
+                        "name": "X-Real-IP",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Blocklist entry",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.BlockRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Number of disabled links",
+                        "schema": {
+                            "$ref": "#/definitions/models.BlockResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Error reading body!/Error unmarshalling body!/Invalid blocklist entry!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "No CIDR set!/IP address is not trusted!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Error blocking destination!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/internal/stats": {
+            "get": {
+                "description": "shows service stats",
+                "consumes": [
+                    "text/plain"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "stats"
+                ],
+                "summary": "Get service statistics",
+                "responses": {
+                    "200": {
+                        "description": "Sucess",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Stats not found!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden IP!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
                         }
                     }
                 }
             }
         },
-        "/api/shorten/batch": {
+        "/api/v1/shorten": {
             "post": {
                 "security": [
                     {
                         "Bearer": []
                     }
                 ],
-                "description": "Creates shortened versions for multiple URLs in a single request",
+                "description": "Creates a shortened version of a URL provided in JSON format\nLinks to this service and to known external shorteners are resolved to their final destination",
                 "consumes": [
                     "application/json"
                 ],
@@ -84,7 +202,7 @@ const docTemplate = `{
                 "tags": [
                     "urls"
                 ],
-                "summary": "Shorten multiple URLs in batch",
+                "summary": "Shorten URL via JSON",
                 "parameters": [
                     {
                         "type": "string",
@@ -94,55 +212,69 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "description": "Array of URLs to shorten",
+                        "description": "URL to shorten",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/models.BatchUnitURLRequest"
-                            }
+                            "$ref": "#/definitions/models.ShortenURLRequest"
                         }
                     }
                 ],
                 "responses": {
                     "201": {
-                        "description": "Array of shortened URLs",
+                        "description": "Shortened URL",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/models.BatchUnitURLResponse"
-                            }
+                            "$ref": "#/definitions/models.ShortenURLResponse"
                         }
                     },
                     "400": {
-                        "description": "Error reading body!/Error unmarshalling body!/Empty or malformed body sent!/Error saving URLs!",
+                        "description": "Request has invalid fields!/URL points to this service!/Redirect chain is too long!",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "URL is blocked!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "URL is already shortened, short_url holds the existing link",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request body is too large!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
                         }
                     }
                 }
             }
         },
-        "/api/url": {
+        "/api/v1/shorten/batch": {
             "post": {
                 "security": [
                     {
                         "Bearer": []
                     }
                 ],
-                "description": "Creates a shortened version of a provided URL",
+                "description": "Creates shortened versions for multiple URLs in a single request\nLinks to this service and to known external shorteners are resolved to their final destination\nItems are shortened one by one, each reported as created, existing, invalid, blocked or error.\natomic=true saves all items in one transaction and fails the whole batch on the first error.\nWith Content-Type application/x-ndjson items are read one per line and their results streamed back as NDJSON.",
                 "consumes": [
-                    "text/plain"
+                    "application/json",
+                    "application/x-ndjson"
                 ],
                 "produces": [
-                    "text/plain"
+                    "application/json",
+                    "application/x-ndjson"
                 ],
                 "tags": [
                     "urls"
                 ],
-                "summary": "Create shortened URL",
+                "summary": "Shorten multiple URLs in batch",
                 "parameters": [
                     {
                         "type": "string",
@@ -152,50 +284,74 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "description": "Original URL to shorten",
-                        "name": "url",
+                        "description": "Array of URLs to shorten",
+                        "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.BatchUnitURLRequest"
+                            }
                         }
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Save all items or none",
+                        "name": "atomic",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "201": {
-                        "description": "Shortened URL",
+                        "description": "Array of shortened URLs",
                         "schema": {
-                            "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.BatchUnitURLResponse"
+                            }
+                        }
+                    },
+                    "207": {
+                        "description": "Result of every item when some failed",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.BatchUnitURLResponse"
+                            }
                         }
                     },
                     "400": {
-                        "description": "Can't read body!/Empty body!/Malformed URI!/Couldn't encode URL!",
+                        "description": "Atomic batches can't be streamed!",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/models.Problem"
                         }
                     },
-                    "409": {
-                        "description": "URL already exists",
+                    "403": {
+                        "description": "URL is blocked!",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Too many items!/Request body is too large!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
                         }
                     }
                 }
             }
         },
-        "/api/urls": {
-            "delete": {
-                "description": "Delete multiple URLs for a specific user",
+        "/api/v1/user/domain": {
+            "put": {
+                "description": "Chooses the branded domain new links of the user are created on, \"\" for the default one",
                 "consumes": [
                     "application/json"
                 ],
-                "produces": [
-                    "text/plain"
-                ],
                 "tags": [
                     "urls"
                 ],
-                "summary": "Delete URLs",
+                "summary": "Set default short domain",
                 "parameters": [
                     {
                         "type": "string",
@@ -205,37 +361,34 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "description": "Array of URLs to delete",
+                        "description": "Default domain",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/models.DomainRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "202": {
-                        "description": "Accepted",
+                    "204": {
+                        "description": "No Content",
                         "schema": {
                             "type": "string"
                         }
                     },
                     "400": {
-                        "description": "Error reading body!/Error unmarshalling body!/Empty or malformed body sent!",
+                        "description": "Error reading body!/Error unmarshalling body!/Unknown domain!",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/models.Problem"
                         }
                     }
                 }
             }
         },
-        "/api/user/urls": {
+        "/api/v1/user/urls": {
             "get": {
-                "description": "Retrieves all URLs associated with the authenticated user",
+                "description": "Retrieves all URLs associated with the authenticated user\nThe health filter selects links whose destination was last found broken or ok by the health checker",
                 "consumes": [
                     "application/json"
                 ],
@@ -253,6 +406,12 @@ const docTemplate = `{
                         "name": "Authorization",
                         "in": "header",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Destination health filter: broken or ok",
+                        "name": "health",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -272,85 +431,600 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Error finding URLs!",
+                        "description": "Error finding URLs!/Unknown health filter!",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/models.Problem"
                         }
                     }
                 }
-            }
-        },
-        "/ping": {
-            "get": {
-                "description": "Check if database connection is alive",
+            },
+            "delete": {
+                "description": "Delete multiple URLs of a specific user on one domain",
                 "consumes": [
-                    "text/plain"
+                    "application/json"
                 ],
                 "produces": [
                     "text/plain"
                 ],
                 "tags": [
-                    "health"
+                    "urls"
+                ],
+                "summary": "Delete URLs",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer JWT token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Branded domain of the links",
+                        "name": "domain",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Array of URLs to delete",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "type": "string"
+                            }
+                        }
+                    }
                 ],
-                "summary": "Ping database",
                 "responses": {
-                    "200": {
-                        "description": "Live",
+                    "202": {
+                        "description": "Accepted",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "500": {
-                        "description": "Can't connect to the Database!",
+                    "400": {
+                        "description": "Error reading body!/Error unmarshalling body!/Empty or malformed body sent!",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/models.Problem"
                         }
                     }
                 }
             }
         },
-        "/{id}": {
+        "/api/v1/user/urls/export": {
             "get": {
-                "description": "Retrieves and redirects to the original URL from a shortened URL ID",
-                "consumes": [
-                    "text/plain"
-                ],
+                "description": "Streams every link of the authenticated user, deleted ones included, with its settings, tags and total clicks.\nCSV exports can be imported again with POST /api/user/urls/import. Responses are gzip encoded when accepted.",
                 "produces": [
-                    "text/plain"
+                    "application/json",
+                    "text/csv",
+                    "application/x-ndjson"
                 ],
                 "tags": [
                     "urls"
                 ],
-                "summary": "Get original URL",
+                "summary": "Export user's URLs",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Shortened URL ID",
-                        "name": "id",
-                        "in": "path",
+                        "description": "Bearer JWT token",
+                        "name": "Authorization",
+                        "in": "header",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "json (default), csv or ndjson",
+                        "name": "format",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "307": {
-                        "description": "Temporary Redirect",
+                    "200": {
+                        "description": "User's links",
                         "schema": {
-                            "type": "string"
-                        },
-                        "headers": {
-                            "Location": {
-                                "type": "string",
-                                "description": "Original URL for redirect"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.ExportURL"
                             }
                         }
                     },
                     "400": {
-                        "description": "URL not found!",
+                        "description": "Unknown export format!/Error exporting URLs!",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/models.Problem"
                         }
-                    },
-                    "410": {
+                    }
+                }
+            }
+        },
+        "/api/v1/user/urls/import": {
+            "post": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Creates links from a CSV file with a header row (url, alias, tags, expires_at, domain, deleted) or from NDJSON objects with the same fields.\nRows are validated like batch shortening and reported one by one, so invalid rows don't fail the whole import.\nRows of deleted links, as in CSV exports, are skipped.\nTags in CSV are separated by ';', expiries are RFC 3339 timestamps or YYYY-MM-DD dates.",
+                "consumes": [
+                    "text/csv",
+                    "application/x-ndjson"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "urls"
+                ],
+                "summary": "Import links",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer JWT token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "csv or ndjson, taken from Content-Type by default",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "description": "CSV or NDJSON rows",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Result of every row",
+                        "schema": {
+                            "$ref": "#/definitions/models.ImportReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Error reading body!/CSV header has no url column!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request body is too large!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported import format!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/user/urls/{id}": {
+            "patch": {
+                "description": "Partially updates the settings of a link owned by the user, including its social card",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "urls"
+                ],
+                "summary": "Update link settings",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer JWT token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Shortened URL ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Branded domain of the link",
+                        "name": "domain",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Link settings to change",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UpdateURLRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Updated link",
+                        "schema": {
+                            "$ref": "#/definitions/models.UserURLResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Error reading body!/Error unmarshalling body!/Invalid link settings!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "URL belongs to another user!/URL is blocked!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "URL not found!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "URL was deleted!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/user/urls/{id}/qr": {
+            "get": {
+                "description": "Renders a QR code encoding the full short URL of a link owned by the user",
+                "produces": [
+                    "image/png",
+                    "image/svg+xml"
+                ],
+                "tags": [
+                    "qr"
+                ],
+                "summary": "Get QR code for a user's short URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer JWT token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Shortened URL ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Branded domain of the link",
+                        "name": "domain",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "png (default) or svg",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Image size in pixels, 32-2048 (default 256)",
+                        "name": "size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Quiet zone in modules, 0-32 (default 4)",
+                        "name": "margin",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Error correction level L, M (default), Q or H",
+                        "name": "level",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Foreground hex color (default 000000)",
+                        "name": "fg",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Background hex color (default ffffff)",
+                        "name": "bg",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "QR code image",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid QR code options!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "URL belongs to another user!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "URL not found!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "URL was deleted!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/user/urls/{id}/stats": {
+            "get": {
+                "description": "Returns the number of redirects of a user's link broken down by country",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "stats"
+                ],
+                "summary": "Get link click analytics",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer JWT token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Shortened URL ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Branded domain of the link",
+                        "name": "domain",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Click analytics",
+                        "schema": {
+                            "$ref": "#/definitions/models.ClickStats"
+                        }
+                    },
+                    "403": {
+                        "description": "URL belongs to another user!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "URL not found!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    },
+                    "410": {
+                        "description": "URL was deleted!",
+                        "schema": {
+                            "$ref": "#/definitions/models.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/ping": {
+            "get": {
+                "description": "Check if database connection is alive",
+                "consumes": [
+                    "text/plain"
+                ],
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Ping database",
+                "responses": {
+                    "200": {
+                        "description": "Live",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Can't connect to the Database!",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/{id}": {
+            "get": {
+                "description": "Retrieves and redirects to the original URL from a shortened URL ID on the domain serving the request.\nVisitors matching one of the link's device, language, country or time rules are sent to the rule's destination.\nLinks with A/B variants send each visitor to a weighted variant remembered in a cookie.\nIncoming query parameters are merged according to the link's query policy.\nLinks disabled because their destination is blocked render a warning page.\nDestinations found on a threat list render a warning interstitial instead of redirecting.\nLink unfurling bots get a page with Open Graph and Twitter Card tags unless the link disables social cards.\nAppending \"+\" to the ID or passing preview=1 renders a preview page instead of redirecting.",
+                "consumes": [
+                    "text/plain"
+                ],
+                "produces": [
+                    "text/plain",
+                    "text/html"
+                ],
+                "tags": [
+                    "urls"
+                ],
+                "summary": "Get original URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Shortened URL ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Render a preview page",
+                        "name": "preview",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Preview page/Threat warning page/Social card",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "307": {
+                        "description": "Temporary Redirect",
+                        "schema": {
+                            "type": "string"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "Original URL for redirect"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "URL not found!",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Link disabled warning page",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "410": {
+                        "description": "URL was deleted!/URL has expired!",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/{id}/qr": {
+            "get": {
+                "description": "Renders a QR code encoding the full short URL on the domain serving the request",
+                "produces": [
+                    "image/png",
+                    "image/svg+xml"
+                ],
+                "tags": [
+                    "qr"
+                ],
+                "summary": "Get QR code for a short URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Shortened URL ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "png (default) or svg",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Image size in pixels, 32-2048 (default 256)",
+                        "name": "size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Quiet zone in modules, 0-32 (default 4)",
+                        "name": "margin",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Error correction level L, M (default), Q or H",
+                        "name": "level",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Foreground hex color (default 000000)",
+                        "name": "fg",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Background hex color (default ffffff)",
+                        "name": "bg",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "QR code image",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid QR code options!",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "URL not found!",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "410": {
                         "description": "URL was deleted!",
                         "schema": {
                             "type": "string"
@@ -367,6 +1041,9 @@ const docTemplate = `{
                 "correlation_id": {
                     "type": "string"
                 },
+                "domain": {
+                    "type": "string"
+                },
                 "original_url": {
                     "type": "string"
                 },
@@ -381,14 +1058,333 @@ const docTemplate = `{
                 "correlation_id": {
                     "type": "string"
                 },
+                "error": {
+                    "type": "string"
+                },
+                "short_url": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.BlockRequest": {
+            "type": "object",
+            "properties": {
+                "entry": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.BlockResponse": {
+            "type": "object",
+            "properties": {
+                "disabled": {
+                    "type": "integer"
+                },
+                "entry": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Card": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "image": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ClickStats": {
+            "type": "object",
+            "properties": {
+                "clicks": {
+                    "type": "integer"
+                },
+                "countries": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "variants": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "models.DomainRequest": {
+            "type": "object",
+            "properties": {
+                "domain": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ExportURL": {
+            "type": "object",
+            "properties": {
+                "card": {
+                    "$ref": "#/definitions/models.Card"
+                },
+                "clicks": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "deleted": {
+                    "type": "boolean"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "disabled": {
+                    "type": "boolean"
+                },
+                "domain": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "health": {
+                    "$ref": "#/definitions/models.Health"
+                },
+                "metadata": {
+                    "$ref": "#/definitions/models.Metadata"
+                },
+                "original_url": {
+                    "type": "string"
+                },
+                "query_policy": {
+                    "type": "string"
+                },
+                "rules": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Rule"
+                    }
+                },
+                "short_url": {
+                    "type": "string"
+                },
+                "social_card": {
+                    "type": "boolean"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "title": {
+                    "type": "string"
+                },
+                "utm": {
+                    "$ref": "#/definitions/models.UTM"
+                },
+                "variants": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Variant"
+                    }
+                },
+                "winner": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.FieldError": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "field": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Health": {
+            "type": "object",
+            "properties": {
+                "checked_at": {
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Network error if the destination didn't respond",
+                    "type": "string"
+                },
+                "latency_ms": {
+                    "description": "Time to the response headers in milliseconds",
+                    "type": "integer"
+                },
+                "status": {
+                    "description": "HTTP status code of the destination",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.ImportReport": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "type": "integer"
+                },
+                "existing": {
+                    "type": "integer"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ImportResult"
+                    }
+                },
+                "skipped": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.ImportResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "row": {
+                    "type": "integer"
+                },
+                "short_url": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Metadata": {
+            "type": "object",
+            "properties": {
+                "fetched_at": {
+                    "type": "string"
+                },
+                "og_description": {
+                    "type": "string"
+                },
+                "og_image": {
+                    "type": "string"
+                },
+                "og_title": {
+                    "type": "string"
+                },
+                "title": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Problem": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "detail": {
+                    "type": "string"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.FieldError"
+                    }
+                },
+                "instance": {
+                    "type": "string"
+                },
                 "short_url": {
                     "type": "string"
+                },
+                "status": {
+                    "type": "integer"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Rule": {
+            "type": "object",
+            "properties": {
+                "country": {
+                    "description": "ISO 3166-1 alpha-2 country codes of the client IP",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "device": {
+                    "description": "mobile, tablet, desktop or bot",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "from": {
+                    "description": "Start of the time of day window, HH:MM",
+                    "type": "string"
+                },
+                "language": {
+                    "description": "Language tags matched against the preferred Accept-Language",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "os": {
+                    "description": "ios, android, windows, macos, chromeos or linux",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "timezone": {
+                    "description": "IANA time zone of the window, UTC by default",
+                    "type": "string"
+                },
+                "to": {
+                    "description": "End of the time of day window, HH:MM, exclusive",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "Destination for matching visitors",
+                    "type": "string"
                 }
             }
         },
         "models.ShortenURLRequest": {
             "type": "object",
             "properties": {
+                "domain": {
+                    "type": "string"
+                },
                 "url": {
                     "type": "string"
                 }
@@ -402,14 +1398,146 @@ const docTemplate = `{
                 }
             }
         },
+        "models.UTM": {
+            "type": "object",
+            "properties": {
+                "campaign": {
+                    "type": "string"
+                },
+                "content": {
+                    "type": "string"
+                },
+                "medium": {
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "term": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.UpdateURLRequest": {
+            "type": "object",
+            "properties": {
+                "card": {
+                    "$ref": "#/definitions/models.Card"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "query_policy": {
+                    "type": "string"
+                },
+                "rules": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Rule"
+                    }
+                },
+                "social_card": {
+                    "type": "boolean"
+                },
+                "title": {
+                    "type": "string"
+                },
+                "utm": {
+                    "$ref": "#/definitions/models.UTM"
+                },
+                "variants": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Variant"
+                    }
+                },
+                "winner": {
+                    "type": "string"
+                }
+            }
+        },
         "models.UserURLResponse": {
             "type": "object",
             "properties": {
+                "card": {
+                    "$ref": "#/definitions/models.Card"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "disabled": {
+                    "type": "boolean"
+                },
+                "domain": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "health": {
+                    "$ref": "#/definitions/models.Health"
+                },
+                "metadata": {
+                    "$ref": "#/definitions/models.Metadata"
+                },
                 "original_url": {
                     "type": "string"
                 },
+                "query_policy": {
+                    "type": "string"
+                },
+                "rules": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Rule"
+                    }
+                },
                 "short_url": {
                     "type": "string"
+                },
+                "social_card": {
+                    "type": "boolean"
+                },
+                "tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "title": {
+                    "type": "string"
+                },
+                "utm": {
+                    "$ref": "#/definitions/models.UTM"
+                },
+                "variants": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Variant"
+                    }
+                },
+                "winner": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Variant": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "description": "Short identifier, also stored in the visitor's cookie",
+                    "type": "string"
+                },
+                "url": {
+                    "description": "Destination of the variant",
+                    "type": "string"
+                },
+                "weight": {
+                    "description": "Relative share of traffic, 0 pauses the variant",
+                    "type": "integer"
                 }
             }
         }
@@ -420,7 +1548,7 @@ const docTemplate = `{
 var SwaggerInfo = &swag.Spec{
 	Version:          "1.0",
 	Host:             "localhost:8080",
-	BasePath:         "/api/v1",
+	BasePath:         "/",
 	Schemes:          []string{},
 	Title:            "URL Shortener API",
 	Description:      "A URL shortening service API",
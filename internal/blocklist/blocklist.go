@@ -0,0 +1,177 @@
+// Package blocklist matches destination URLs against blocked domains and URL patterns.
+//
+// A blocklist file holds one entry per line, blank lines and lines starting with # are ignored:
+//
+//	evil.com           the host evil.com
+//	*.evil.com         any subdomain of evil.com
+//	re:^https?://[^/]+/phish  a regular expression matched against the whole URL
+package blocklist
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// regexPrefix marks entries holding a regular expression
+const regexPrefix = "re:"
+
+// ErrorInvalidEntry is returned for entries that are neither a domain, a wildcard nor a valid regular expression
+var ErrorInvalidEntry = errors.New("invalid blocklist entry")
+
+// List is a reloadable set of blocklist entries, optionally backed by a file
+type List struct {
+	mu      sync.RWMutex
+	path    string
+	entries []entry
+}
+
+// entry is a single parsed blocklist line
+type entry struct {
+	raw      string
+	host     string
+	wildcard bool
+	pattern  *regexp.Regexp
+}
+
+// Open loads the blocklist at path. A missing file yields an empty list that is created on the first Add,
+// an empty path keeps the list in memory only.
+func Open(path string) (*List, error) {
+	l := &List{path: path}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload rereads the blocklist file, keeping the current entries if the file can't be parsed
+func (l *List) Reload() error {
+	if l.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(l.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var entries []entry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		e, err := parse(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", l.path, n, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.entries = entries
+	l.mu.Unlock()
+	return nil
+}
+
+// Add validates an entry, appends it to the blocklist file and starts matching it immediately
+func (l *List) Add(raw string) error {
+	e, err := parse(strings.TrimSpace(raw))
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.path != "" {
+		f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(f, e.raw)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	l.entries = append(l.entries, e)
+	return nil
+}
+
+// Blocked reports whether rawURL matches the blocklist, returning the matching entry
+func (l *List) Blocked(rawURL string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+
+	var host string
+	if u, err := url.Parse(rawURL); err == nil {
+		host = strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, e := range l.entries {
+		if e.match(rawURL, host) {
+			return e.raw, true
+		}
+	}
+	return "", false
+}
+
+// match reports whether the entry matches a URL with the given lowercased host
+func (e entry) match(rawURL, host string) bool {
+	switch {
+	case e.pattern != nil:
+		return e.pattern.MatchString(rawURL)
+	case host == "":
+		return false
+	case e.wildcard:
+		return strings.HasSuffix(host, "."+e.host)
+	default:
+		return host == e.host
+	}
+}
+
+// parse validates a single blocklist entry
+func parse(raw string) (entry, error) {
+	if expr, ok := strings.CutPrefix(raw, regexPrefix); ok {
+		pattern, err := regexp.Compile(expr)
+		if err != nil || expr == "" {
+			return entry{}, ErrorInvalidEntry
+		}
+		return entry{raw: raw, pattern: pattern}, nil
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(raw), ".")
+	wildcard := false
+	if rest, ok := strings.CutPrefix(host, "*."); ok {
+		host, wildcard = rest, true
+	}
+
+	if host == "" || strings.ContainsAny(host, "/:?#*@ \t") {
+		return entry{}, ErrorInvalidEntry
+	}
+	if wildcard {
+		raw = "*." + host
+	} else {
+		raw = host
+	}
+	return entry{raw: raw, host: host, wildcard: wildcard}, nil
+}
@@ -2,13 +2,21 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	env "github.com/caarlos0/env/v11"
 	// "github.com/joho/godotenv"
 )
 
+// ErrorDomain is returned for an entry of Domains that isn't a base URL with a host
+var ErrorDomain = errors.New("branded domain must be a base URL such as https://go.example.com")
+
 // Config holds the application configuration settings.
 // It can be populated from environment variables using the env tags.
 type Config struct {
@@ -26,25 +34,165 @@ type Config struct {
 	HTTPS bool `env:"HTTPS"`
 	// TrustedSubnet shows trusted subnets mask
 	TrustedSubnet string `env:"TRUSTED_SUBNET"`
+	// TrustedProxies lists comma separated proxy IPs or CIDRs whose forwarding headers are trusted
+	TrustedProxies string `env:"TRUSTED_PROXIES"`
+	// GeoIPPath specifies the path to a MaxMind-format .mmdb country database
+	GeoIPPath string `env:"GEOIP_DB_PATH"`
+	// Domains lists comma separated base URLs of additional branded short domains
+	Domains string `env:"DOMAINS"`
+	// StripTracking removes tracking parameters such as utm_* from the canonical form of URLs
+	StripTracking bool `env:"STRIP_TRACKING_PARAMS"`
+	// BlocklistPath specifies the path to the file of blocked domains and URL patterns
+	BlocklistPath string `env:"BLOCKLIST_PATH"`
+	// ThreatListPath specifies the path to the stored hash-prefix threat lists
+	ThreatListPath string `env:"THREAT_LIST_PATH"`
+	// ThreatListSource is the URL or file path threat list updates are fetched from
+	ThreatListSource string `env:"THREAT_LIST_UPDATE_URL"`
+	// ThreatListInterval is the period between threat list updates
+	ThreatListInterval time.Duration `env:"THREAT_LIST_UPDATE_INTERVAL"`
+	// ThreatLists lists comma separated THREAT_TYPE/PLATFORM_TYPE/THREAT_ENTRY_TYPE descriptors of the lists to fetch, a built-in list by default
+	ThreatLists string `env:"THREAT_LISTS"`
+	// ExpandShorteners follows links of external URL shorteners to their destination on creation
+	ExpandShorteners bool `env:"EXPAND_SHORTENERS"`
+	// ShortenerHosts lists comma separated hosts of external URL shorteners, a built-in list by default
+	ShortenerHosts string `env:"SHORTENER_HOSTS"`
+	// MaxRedirectDepth limits how many short links are followed when resolving a destination
+	MaxRedirectDepth int `env:"MAX_REDIRECT_DEPTH"`
+	// HealthInterval is the period between destination health checks, 0 disables them
+	HealthInterval time.Duration `env:"HEALTH_CHECK_INTERVAL"`
+	// HealthConcurrency limits the number of concurrent destination health checks
+	HealthConcurrency int `env:"HEALTH_CHECK_CONCURRENCY"`
+	// HealthHostDelay is the minimum delay between health checks of the same host
+	HealthHostDelay time.Duration `env:"HEALTH_CHECK_HOST_DELAY"`
+	// FetchMetadata enables fetching the title and Open Graph tags of new links' destinations
+	FetchMetadata bool `env:"FETCH_METADATA"`
+	// MetadataMaxBytes limits how much of a destination page is read for its metadata
+	MetadataMaxBytes int64 `env:"METADATA_MAX_BYTES"`
+	// MetadataTimeout limits the time spent fetching the metadata of a destination
+	MetadataTimeout time.Duration `env:"METADATA_TIMEOUT"`
+	// BotUserAgents lists comma separated User-Agent substrings of link unfurling bots, a built-in list by default
+	BotUserAgents string `env:"BOT_USER_AGENTS"`
+	// BatchMaxItems limits the number of items of a single batch request
+	BatchMaxItems int `env:"BATCH_MAX_ITEMS"`
+	// IdempotencyTTL is how long responses to requests with an Idempotency-Key are replayed, 24 hours by default
+	IdempotencyTTL time.Duration `env:"IDEMPOTENCY_TTL"`
+	// MaxBodyBytes limits the size of request bodies as sent
+	MaxBodyBytes int64 `env:"MAX_BODY_BYTES"`
+	// MaxDecompressedBytes limits the size of gzip encoded request bodies once inflated
+	MaxDecompressedBytes int64 `env:"MAX_DECOMPRESSED_BYTES"`
+	// MaxURLLength limits the length of URLs to shorten
+	MaxURLLength int `env:"MAX_URL_LENGTH"`
+	// AllowedSchemes lists comma separated URL schemes that can be shortened, http and https by default
+	AllowedSchemes string `env:"ALLOWED_SCHEMES"`
+	// RateLimitCreate limits creating links per client as requests per period, e.g. "60/1m" or "60/1m:10" with a burst of 10
+	RateLimitCreate string `env:"RATE_LIMIT_CREATE"`
+	// RateLimitRedirect limits redirects per client as requests per period, e.g. "60/1m" or "60/1m:10" with a burst of 10
+	RateLimitRedirect string `env:"RATE_LIMIT_REDIRECT"`
+	// RateLimitDelete limits deleting links per client as requests per period, e.g. "60/1m" or "60/1m:10" with a burst of 10
+	RateLimitDelete string `env:"RATE_LIMIT_DELETE"`
+	// RateLimitKeys lists comma separated API keys whose clients are rate limited per key when sent in X-API-Key
+	RateLimitKeys string `env:"RATE_LIMIT_KEYS"`
+	// MetricsAddr is the host:port of the admin listener serving Prometheus metrics, empty to disable it
+	MetricsAddr string `env:"METRICS_ADDRESS"`
+	// TracingExporter selects where spans are sent: "otlp", "stdout" or "none"
+	TracingExporter string `env:"TRACING_EXPORTER"`
+	// DomainBases maps the hosts of the branded domains to their base URLs, parsed from Domains by ParseDomains
+	DomainBases map[string]string
 }
 
 type tempCfg struct {
 	// ServerAddr specifies the server address in format host:port
-	ServerAddr string `env:"server_address"`
+	ServerAddr string `json:"server_address"`
 	// BaseURL is the base URL for the shortened URLs
-	BaseURL string `env:"base_url"`
+	BaseURL string `json:"base_url"`
 	// StoragePath specifies the path to the file storage
-	StoragePath string `env:"file_storage_path"`
+	StoragePath string `json:"file_storage_path"`
 	// DBAddress holds the database connection string
-	DBAddress string `env:"database_dsn" envDefault:""`
+	DBAddress string `json:"database_dsn"`
 	// HTTPS indicates whether the server should run with HTTPS
-	HTTPS bool `env:"enable_https"`
+	HTTPS bool `json:"enable_https"`
 	// TrustedSubnet shows trusted subnets mask
-	TrustedSubnet string `env:"TRUSTED_SUBNET"`
+	TrustedSubnet string `json:"trusted_subnet"`
+	// TrustedProxies lists comma separated proxy IPs or CIDRs whose forwarding headers are trusted
+	TrustedProxies string `json:"trusted_proxies"`
+	// GeoIPPath specifies the path to a MaxMind-format .mmdb country database
+	GeoIPPath string `json:"geoip_db_path"`
+	// Domains lists comma separated base URLs of additional branded short domains
+	Domains string `json:"domains"`
+	// StripTracking removes tracking parameters such as utm_* from the canonical form of URLs
+	StripTracking bool `json:"strip_tracking_params"`
+	// BlocklistPath specifies the path to the file of blocked domains and URL patterns
+	BlocklistPath string `json:"blocklist_path"`
+	// ThreatListPath specifies the path to the stored hash-prefix threat lists
+	ThreatListPath string `json:"threat_list_path"`
+	// ThreatListSource is the URL or file path threat list updates are fetched from
+	ThreatListSource string `json:"threat_list_update_url"`
+	// ThreatListInterval is the period between threat list updates, e.g. "30m"
+	ThreatListInterval string `json:"threat_list_update_interval"`
+	// ThreatLists lists comma separated THREAT_TYPE/PLATFORM_TYPE/THREAT_ENTRY_TYPE descriptors of the lists to fetch, a built-in list by default
+	ThreatLists string `json:"threat_lists"`
+	// ExpandShorteners follows links of external URL shorteners to their destination on creation
+	ExpandShorteners bool `json:"expand_shorteners"`
+	// ShortenerHosts lists comma separated hosts of external URL shorteners, a built-in list by default
+	ShortenerHosts string `json:"shortener_hosts"`
+	// MaxRedirectDepth limits how many short links are followed when resolving a destination
+	MaxRedirectDepth int `json:"max_redirect_depth"`
+	// HealthInterval is the period between destination health checks, e.g. "1h"
+	HealthInterval string `json:"health_check_interval"`
+	// HealthConcurrency limits the number of concurrent destination health checks
+	HealthConcurrency int `json:"health_check_concurrency"`
+	// HealthHostDelay is the minimum delay between health checks of the same host, e.g. "1s"
+	HealthHostDelay string `json:"health_check_host_delay"`
+	// FetchMetadata enables fetching the title and Open Graph tags of new links' destinations
+	FetchMetadata bool `json:"fetch_metadata"`
+	// MetadataMaxBytes limits how much of a destination page is read for its metadata
+	MetadataMaxBytes int64 `json:"metadata_max_bytes"`
+	// MetadataTimeout limits the time spent fetching the metadata of a destination, e.g. "5s"
+	MetadataTimeout string `json:"metadata_timeout"`
+	// BotUserAgents lists comma separated User-Agent substrings of link unfurling bots, a built-in list by default
+	BotUserAgents string `json:"bot_user_agents"`
+	// BatchMaxItems limits the number of items of a single batch request
+	BatchMaxItems int `json:"batch_max_items"`
+	// IdempotencyTTL is how long responses to requests with an Idempotency-Key are replayed, 24 hours by default
+	IdempotencyTTL string `json:"idempotency_ttl"`
+	// MaxBodyBytes limits the size of request bodies as sent
+	MaxBodyBytes int64 `json:"max_body_bytes"`
+	// MaxDecompressedBytes limits the size of gzip encoded request bodies once inflated
+	MaxDecompressedBytes int64 `json:"max_decompressed_bytes"`
+	// MaxURLLength limits the length of URLs to shorten
+	MaxURLLength int `json:"max_url_length"`
+	// AllowedSchemes lists comma separated URL schemes that can be shortened, http and https by default
+	AllowedSchemes string `json:"allowed_schemes"`
+	// RateLimitCreate limits creating links per client as requests per period, e.g. "60/1m" or "60/1m:10" with a burst of 10
+	RateLimitCreate string `json:"rate_limit_create"`
+	// RateLimitRedirect limits redirects per client as requests per period, e.g. "60/1m" or "60/1m:10" with a burst of 10
+	RateLimitRedirect string `json:"rate_limit_redirect"`
+	// RateLimitDelete limits deleting links per client as requests per period, e.g. "60/1m" or "60/1m:10" with a burst of 10
+	RateLimitDelete string `json:"rate_limit_delete"`
+	// RateLimitKeys lists comma separated API keys whose clients are rate limited per key when sent in X-API-Key
+	RateLimitKeys string `json:"rate_limit_keys"`
+	// MetricsAddr is the host:port of the admin listener serving Prometheus metrics, empty to disable it
+	MetricsAddr string `json:"metrics_address"`
+	// TracingExporter selects where spans are sent: "otlp", "stdout" or "none"
+	TracingExporter string `json:"tracing_exporter"`
 }
 
+// DefaultRedirectDepth is the number of short links followed when resolving a destination if not configured
+const DefaultRedirectDepth = 5
+
+// DefaultBatchMaxItems is the number of items a batch request may contain if not configured
+const DefaultBatchMaxItems = 100000
+
+// Request limits used if not configured
+const (
+	DefaultMaxBodyBytes         = 16 << 20
+	DefaultMaxDecompressedBytes = 64 << 20
+	DefaultMaxURLLength         = 2048
+	DefaultAllowedSchemes       = "http,https"
+)
+
 // Read parses environment variables into the Config struct.
-// It sets default values for ServerAddr, BaseURL, and StoragePath if they are not provided.
+// It sets default values for ServerAddr, BaseURL, StoragePath, ThreatListInterval, MaxRedirectDepth, health check, metadata, batch, idempotency and request limits if they are not provided.
 // The function will log.Fatal if environment parsing fails.
 func Read(cfg *Config) {
 	err := env.Parse(cfg)
@@ -63,6 +211,54 @@ func Read(cfg *Config) {
 	if cfg.StoragePath == "" {
 		cfg.StoragePath = "urls.json"
 	}
+
+	if cfg.ThreatListInterval <= 0 {
+		cfg.ThreatListInterval = 30 * time.Minute
+	}
+
+	if cfg.MaxRedirectDepth <= 0 {
+		cfg.MaxRedirectDepth = DefaultRedirectDepth
+	}
+
+	if cfg.HealthConcurrency <= 0 {
+		cfg.HealthConcurrency = 4
+	}
+
+	if cfg.HealthHostDelay <= 0 {
+		cfg.HealthHostDelay = time.Second
+	}
+
+	if cfg.MetadataMaxBytes <= 0 {
+		cfg.MetadataMaxBytes = 512 << 10
+	}
+
+	if cfg.MetadataTimeout <= 0 {
+		cfg.MetadataTimeout = 5 * time.Second
+	}
+
+	if cfg.BatchMaxItems <= 0 {
+		cfg.BatchMaxItems = DefaultBatchMaxItems
+	}
+
+	if cfg.IdempotencyTTL <= 0 {
+		cfg.IdempotencyTTL = 24 * time.Hour
+	}
+
+	if cfg.MaxBodyBytes <= 0 {
+		cfg.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+
+	if cfg.MaxDecompressedBytes <= 0 {
+		cfg.MaxDecompressedBytes = DefaultMaxDecompressedBytes
+	}
+
+	if cfg.MaxURLLength <= 0 {
+		cfg.MaxURLLength = DefaultMaxURLLength
+	}
+
+	if cfg.AllowedSchemes == "" {
+		cfg.AllowedSchemes = DefaultAllowedSchemes
+	}
 }
 
 // New parses JSON variables into the Config struct.
@@ -103,6 +299,42 @@ func New(cfg *Config) error {
 		if tempCfg.DBAddress != "" {
 			cfg.DBAddress = tempCfg.DBAddress
 		}
+
+		if tempCfg.TrustedProxies != "" {
+			cfg.TrustedProxies = tempCfg.TrustedProxies
+		}
+
+		if tempCfg.GeoIPPath != "" {
+			cfg.GeoIPPath = tempCfg.GeoIPPath
+		}
+
+		if tempCfg.Domains != "" {
+			cfg.Domains = tempCfg.Domains
+		}
+
+		if tempCfg.BlocklistPath != "" {
+			cfg.BlocklistPath = tempCfg.BlocklistPath
+		}
+
+		if tempCfg.ThreatListPath != "" {
+			cfg.ThreatListPath = tempCfg.ThreatListPath
+		}
+
+		if tempCfg.ThreatListSource != "" {
+			cfg.ThreatListSource = tempCfg.ThreatListSource
+		}
+
+		if tempCfg.ThreatListInterval != "" {
+			interval, err := time.ParseDuration(tempCfg.ThreatListInterval)
+			if err != nil {
+				return err
+			}
+			cfg.ThreatListInterval = interval
+		}
+
+		if tempCfg.ThreatLists != "" {
+			cfg.ThreatLists = tempCfg.ThreatLists
+		}
 		// } else {
 		// 	cfg.DBAddress = os.Getenv("DATABASE_DSN")
 		// }
@@ -110,7 +342,266 @@ func New(cfg *Config) error {
 		if tempCfg.HTTPS {
 			cfg.HTTPS = tempCfg.HTTPS
 		}
+
+		if tempCfg.StripTracking {
+			cfg.StripTracking = tempCfg.StripTracking
+		}
+
+		if tempCfg.ExpandShorteners {
+			cfg.ExpandShorteners = tempCfg.ExpandShorteners
+		}
+
+		if tempCfg.ShortenerHosts != "" {
+			cfg.ShortenerHosts = tempCfg.ShortenerHosts
+		}
+
+		if tempCfg.MaxRedirectDepth != 0 {
+			cfg.MaxRedirectDepth = tempCfg.MaxRedirectDepth
+		}
+
+		if tempCfg.HealthInterval != "" {
+			interval, err := time.ParseDuration(tempCfg.HealthInterval)
+			if err != nil {
+				return err
+			}
+			cfg.HealthInterval = interval
+		}
+
+		if tempCfg.HealthConcurrency != 0 {
+			cfg.HealthConcurrency = tempCfg.HealthConcurrency
+		}
+
+		if tempCfg.HealthHostDelay != "" {
+			delay, err := time.ParseDuration(tempCfg.HealthHostDelay)
+			if err != nil {
+				return err
+			}
+			cfg.HealthHostDelay = delay
+		}
+
+		if tempCfg.FetchMetadata {
+			cfg.FetchMetadata = tempCfg.FetchMetadata
+		}
+
+		if tempCfg.MetadataMaxBytes != 0 {
+			cfg.MetadataMaxBytes = tempCfg.MetadataMaxBytes
+		}
+
+		if tempCfg.MetadataTimeout != "" {
+			timeout, err := time.ParseDuration(tempCfg.MetadataTimeout)
+			if err != nil {
+				return err
+			}
+			cfg.MetadataTimeout = timeout
+		}
+
+		if tempCfg.BotUserAgents != "" {
+			cfg.BotUserAgents = tempCfg.BotUserAgents
+		}
+
+		if tempCfg.BatchMaxItems != 0 {
+			cfg.BatchMaxItems = tempCfg.BatchMaxItems
+		}
+
+		if tempCfg.IdempotencyTTL != "" {
+			ttl, err := time.ParseDuration(tempCfg.IdempotencyTTL)
+			if err != nil {
+				return err
+			}
+			cfg.IdempotencyTTL = ttl
+		}
+
+		if tempCfg.MaxBodyBytes != 0 {
+			cfg.MaxBodyBytes = tempCfg.MaxBodyBytes
+		}
+
+		if tempCfg.MaxDecompressedBytes != 0 {
+			cfg.MaxDecompressedBytes = tempCfg.MaxDecompressedBytes
+		}
+
+		if tempCfg.MaxURLLength != 0 {
+			cfg.MaxURLLength = tempCfg.MaxURLLength
+		}
+
+		if tempCfg.AllowedSchemes != "" {
+			cfg.AllowedSchemes = tempCfg.AllowedSchemes
+		}
+
+		if tempCfg.RateLimitCreate != "" {
+			cfg.RateLimitCreate = tempCfg.RateLimitCreate
+		}
+
+		if tempCfg.RateLimitRedirect != "" {
+			cfg.RateLimitRedirect = tempCfg.RateLimitRedirect
+		}
+
+		if tempCfg.RateLimitDelete != "" {
+			cfg.RateLimitDelete = tempCfg.RateLimitDelete
+		}
+
+		if tempCfg.RateLimitKeys != "" {
+			cfg.RateLimitKeys = tempCfg.RateLimitKeys
+		}
+
+		if tempCfg.MetricsAddr != "" {
+			cfg.MetricsAddr = tempCfg.MetricsAddr
+		}
+
+		if tempCfg.TracingExporter != "" {
+			cfg.TracingExporter = tempCfg.TracingExporter
+		}
 	}
 	Read(cfg)
+	return cfg.ParseDomains()
+}
+
+// Proxies returns the trusted proxy list split into separate entries
+func (cfg Config) Proxies() []string {
+	var res []string
+	for _, p := range strings.Split(cfg.TrustedProxies, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// LimitKeys returns the API keys rate limited on their own split into separate entries
+func (cfg Config) LimitKeys() []string {
+	var res []string
+	for _, k := range strings.Split(cfg.RateLimitKeys, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
+// ParseDomains fills DomainBases from the comma separated base URLs of Domains,
+// failing with ErrorDomain on the first entry that has no host
+func (cfg *Config) ParseDomains() error {
+	res := make(map[string]string)
+	for _, base := range strings.Split(cfg.Domains, ",") {
+		base = strings.TrimRight(strings.TrimSpace(base), "/")
+		if base == "" {
+			continue
+		}
+		u, err := url.Parse(base)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("%w: %q", ErrorDomain, base)
+		}
+		res[strings.ToLower(u.Host)] = base
+	}
+	cfg.DomainBases = res
 	return nil
 }
+
+// HasDomain reports whether domain is the default one ("") or a configured branded domain
+func (cfg Config) HasDomain(domain string) bool {
+	if domain == "" {
+		return true
+	}
+	_, ok := cfg.DomainBases[strings.ToLower(domain)]
+	return ok
+}
+
+// DomainOf returns the branded domain serving a request Host, or "" for the default BaseURL
+func (cfg Config) DomainOf(host string) string {
+	host = strings.ToLower(host)
+	if _, ok := cfg.DomainBases[host]; ok {
+		return host
+	}
+	return ""
+}
+
+// ShortURL builds the full short URL of a code on the given domain
+func (cfg Config) ShortURL(domain, short string) string {
+	if base, ok := cfg.DomainBases[strings.ToLower(domain)]; ok {
+		return base + "/" + short
+	}
+	return cfg.BaseURL + "/" + short
+}
+
+// ShortCode reports whether rawURL points to one of our short domains, returning the domain and the
+// short URL ID. The ID is empty for URLs that are not a plain short link, such as API or QR routes.
+func (cfg Config) ShortCode(rawURL string) (string, string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", "", false
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Host, "."))
+	base, domain := cfg.BaseURL, ""
+	if b, ok := cfg.DomainBases[host]; ok {
+		base, domain = b, host
+	} else if b, err := url.Parse(cfg.BaseURL); err != nil || !strings.EqualFold(b.Host, host) {
+		return "", "", false
+	}
+
+	b, _ := url.Parse(base)
+	id, ok := strings.CutPrefix(u.Path, strings.TrimRight(b.Path, "/")+"/")
+	if !ok || strings.Contains(id, "/") {
+		return domain, "", true
+	}
+	return domain, strings.TrimSuffix(id, "+"), true
+}
+
+// Shorteners returns the hosts of external URL shorteners followed on creation, nil if disabled
+func (cfg Config) Shorteners(defaults []string) []string {
+	if !cfg.ExpandShorteners {
+		return nil
+	}
+
+	var res []string
+	for _, h := range strings.Split(cfg.ShortenerHosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			res = append(res, h)
+		}
+	}
+	if len(res) == 0 {
+		return defaults
+	}
+	return res
+}
+
+// ThreatListDescriptors returns the descriptors of the threat lists to fetch, or defaults if none are configured
+func (cfg Config) ThreatListDescriptors(defaults []string) []string {
+	var res []string
+	for _, d := range strings.Split(cfg.ThreatLists, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			res = append(res, d)
+		}
+	}
+	if len(res) == 0 {
+		return defaults
+	}
+	return res
+}
+
+// Unfurlers returns the User-Agent substrings of link unfurling bots, or defaults if none are configured
+func (cfg Config) Unfurlers(defaults []string) []string {
+	var res []string
+	for _, a := range strings.Split(cfg.BotUserAgents, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			res = append(res, a)
+		}
+	}
+	if len(res) == 0 {
+		return defaults
+	}
+	return res
+}
+
+// Schemes returns the lowercase URL schemes that can be shortened, http and https if none are configured
+func (cfg Config) Schemes() []string {
+	var res []string
+	for _, scheme := range strings.Split(cfg.AllowedSchemes, ",") {
+		if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+			res = append(res, scheme)
+		}
+	}
+	if len(res) == 0 {
+		return strings.Split(DefaultAllowedSchemes, ",")
+	}
+	return res
+}
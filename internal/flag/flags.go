@@ -12,6 +12,34 @@ import (
 //	-b: Base HTTP address returned before short URL
 //	-f: Storage file path for URLs
 //	-d: Database connection string
+//	-p: Trusted proxies for client IP resolution
+//	-g: GeoIP country database path
+//	-domains: Additional branded short domains
+//	-strip-tracking: Ignore tracking parameters when deduplicating URLs
+//	-blocklist: Blocklist file path
+//	-threat-list: Stored threat lists path
+//	-threat-list-update: Threat list update URL or file
+//	-threat-list-interval: Period between threat list updates
+//	-threat-lists: Threat lists to fetch
+//	-expand: Follow external shortener links on creation
+//	-shorteners: External shortener hosts
+//	-max-redirects: Maximum short link chain depth
+//	-health-interval: Period between destination health checks
+//	-health-concurrency: Concurrent destination health checks
+//	-health-host-delay: Delay between health checks of one host
+//	-metadata: Fetch destination page titles and Open Graph tags
+//	-bots: User-Agents of link unfurling bots
+//	-batch-max: Maximum number of items in a batch request
+//	-idempotency-ttl: How long Idempotency-Key responses are replayed
+//	-max-body: Maximum request body size
+//	-max-decompressed: Maximum inflated size of gzip request bodies
+//	-max-url-length: Maximum length of URLs to shorten
+//	-schemes: URL schemes that can be shortened
+//	-rate-create: Rate limit of link creation per client
+//	-rate-redirect: Rate limit of redirects per client
+//	-rate-delete: Rate limit of link deletion per client
+//	-metrics-addr: Admin listener address serving Prometheus metrics
+//	-tracing: Exporter of trace spans
 //
 // Returns a populated Config struct with the parsed values.
 func Parse() config.Config {
@@ -23,6 +51,34 @@ func Parse() config.Config {
 	flag.StringVar(&cfg.DBAddress, "d", cfg.DBAddress, "Database connection.")
 	flag.StringVar(&cfg.Config, "c", cfg.Config, "Config in JSON format")
 	flag.StringVar(&cfg.Config, "t", cfg.TrustedSubnet, "Trusted Subnet")
+	flag.StringVar(&cfg.TrustedProxies, "p", cfg.TrustedProxies, "Trusted proxies, comma separated IPs or CIDRs")
+	flag.StringVar(&cfg.GeoIPPath, "g", cfg.GeoIPPath, "GeoIP country database (.mmdb) path")
+	flag.StringVar(&cfg.Domains, "domains", cfg.Domains, "Additional branded short domains, comma separated base URLs")
+	flag.BoolVar(&cfg.StripTracking, "strip-tracking", cfg.StripTracking, "Ignore tracking parameters such as utm_* when deduplicating URLs")
+	flag.StringVar(&cfg.BlocklistPath, "blocklist", cfg.BlocklistPath, "Blocklist file of domains, *.wildcards and re:patterns")
+	flag.StringVar(&cfg.ThreatListPath, "threat-list", cfg.ThreatListPath, "Stored hash-prefix threat lists path")
+	flag.StringVar(&cfg.ThreatListSource, "threat-list-update", cfg.ThreatListSource, "Threat list update URL or file path")
+	flag.DurationVar(&cfg.ThreatListInterval, "threat-list-interval", cfg.ThreatListInterval, "Period between threat list updates")
+	flag.StringVar(&cfg.ThreatLists, "threat-lists", cfg.ThreatLists, "Threat lists to fetch as THREAT_TYPE/PLATFORM_TYPE/THREAT_ENTRY_TYPE, comma separated")
+	flag.BoolVar(&cfg.ExpandShorteners, "expand", cfg.ExpandShorteners, "Follow links of external URL shorteners on creation")
+	flag.StringVar(&cfg.ShortenerHosts, "shorteners", cfg.ShortenerHosts, "External URL shortener hosts, comma separated")
+	flag.IntVar(&cfg.MaxRedirectDepth, "max-redirects", cfg.MaxRedirectDepth, "Maximum number of short links followed to resolve a destination")
+	flag.DurationVar(&cfg.HealthInterval, "health-interval", cfg.HealthInterval, "Period between destination health checks, 0 disables them")
+	flag.IntVar(&cfg.HealthConcurrency, "health-concurrency", cfg.HealthConcurrency, "Number of concurrent destination health checks")
+	flag.DurationVar(&cfg.HealthHostDelay, "health-host-delay", cfg.HealthHostDelay, "Minimum delay between health checks of the same host")
+	flag.BoolVar(&cfg.FetchMetadata, "metadata", cfg.FetchMetadata, "Fetch the title and Open Graph tags of new links' destinations")
+	flag.StringVar(&cfg.BotUserAgents, "bots", cfg.BotUserAgents, "User-Agent substrings of link unfurling bots, comma separated")
+	flag.IntVar(&cfg.BatchMaxItems, "batch-max", cfg.BatchMaxItems, "Maximum number of items in a batch request")
+	flag.DurationVar(&cfg.IdempotencyTTL, "idempotency-ttl", cfg.IdempotencyTTL, "How long responses to requests with an Idempotency-Key are replayed")
+	flag.Int64Var(&cfg.MaxBodyBytes, "max-body", cfg.MaxBodyBytes, "Maximum request body size in bytes")
+	flag.Int64Var(&cfg.MaxDecompressedBytes, "max-decompressed", cfg.MaxDecompressedBytes, "Maximum size of gzip encoded request bodies once inflated, in bytes")
+	flag.IntVar(&cfg.MaxURLLength, "max-url-length", cfg.MaxURLLength, "Maximum length of URLs to shorten")
+	flag.StringVar(&cfg.AllowedSchemes, "schemes", cfg.AllowedSchemes, "URL schemes that can be shortened, comma separated")
+	flag.StringVar(&cfg.RateLimitCreate, "rate-create", cfg.RateLimitCreate, "Link creation limit per client as requests/period[:burst], e.g. 60/1m")
+	flag.StringVar(&cfg.RateLimitRedirect, "rate-redirect", cfg.RateLimitRedirect, "Redirect limit per client as requests/period[:burst], e.g. 600/1m")
+	flag.StringVar(&cfg.RateLimitDelete, "rate-delete", cfg.RateLimitDelete, "Link deletion limit per client as requests/period[:burst], e.g. 30/1m")
+	flag.StringVar(&cfg.MetricsAddr, "metrics-addr", cfg.MetricsAddr, "Admin listener address serving Prometheus metrics at /metrics, empty to disable it")
+	flag.StringVar(&cfg.TracingExporter, "tracing", cfg.TracingExporter, "Exporter of trace spans: otlp, stdout or none")
 	flag.BoolVar(&cfg.HTTPS, "s", cfg.HTTPS, "Enable HTTPS server (true/false)")
 	flag.Parse()
 
@@ -0,0 +1,78 @@
+// Package geoip resolves client IP addresses to countries using a local MaxMind-format database.
+package geoip
+
+import (
+	"net"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// DB is a reloadable country lookup backed by an .mmdb file
+type DB struct {
+	mu     sync.RWMutex
+	path   string
+	reader *maxminddb.Reader
+}
+
+// countryRecord holds the fields read from GeoIP2/GeoLite2 Country and City databases
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// Open loads the database at path
+func Open(path string) (*DB, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{path: path, reader: reader}, nil
+}
+
+// Reload reopens the database file, keeping the current one if the new file can't be loaded
+func (d *DB) Reload() error {
+	reader, err := maxminddb.Open(d.path)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	old := d.reader
+	d.reader = reader
+	d.mu.Unlock()
+
+	return old.Close()
+}
+
+// Country returns the ISO 3166-1 alpha-2 country code of ip, or an empty string if it is unknown
+func (d *DB) Country(ip net.IP) string {
+	if d == nil || ip == nil {
+		return ""
+	}
+
+	var rec countryRecord
+
+	d.mu.RLock()
+	err := d.reader.Lookup(ip, &rec)
+	d.mu.RUnlock()
+	if err != nil {
+		return ""
+	}
+
+	if rec.Country.ISOCode != "" {
+		return rec.Country.ISOCode
+	}
+	return rec.RegisteredCountry.ISOCode
+}
+
+// Close releases the database file
+func (d *DB) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.reader.Close()
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"url-shortener/internal/blocklist"
+	"url-shortener/internal/config"
+	"url-shortener/internal/models"
+	"url-shortener/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Block a destination
+// @Description Adds a domain, wildcard domain (*.example.com) or regular expression (re:...) to the blocklist
+// @Description and disables every existing link whose destination matches it
+// @Tags internal
+// @Accept json
+// @Produce json
+// @Param X-Real-IP header string true "Client IP within the trusted subnet"
+// @Param request body models.BlockRequest true "Blocklist entry"
+// @Success 200 {object} models.BlockResponse "Number of disabled links"
+// @Failure 400 {object} models.Problem "Error reading body!/Error unmarshalling body!/Invalid blocklist entry!"
+// @Failure 403 {object} models.Problem "No CIDR set!/IP address is not trusted!"
+// @Failure 500 {object} models.Problem "Error blocking destination!"
+// @Router /api/v1/internal/blocklist [post]
+func (t *Handler) BlockURL(c *gin.Context, cfg config.Config) {
+	var req models.BlockRequest
+
+	if !trustedIP(c, cfg) {
+		return
+	}
+
+	body, ok := ReadBody(c, "Error reading body!")
+	if !ok {
+		return
+	}
+
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		Fail(c, http.StatusBadRequest, "Error unmarshalling body!", errorBody)
+		return
+	}
+
+	n, err := t.service.Block(c.Request.Context(), req.Entry)
+	if err != nil {
+		if errors.Is(err, blocklist.ErrorInvalidEntry) {
+			Fail(c, http.StatusBadRequest, "Invalid blocklist entry!", err)
+			return
+		}
+		if errors.Is(err, services.ErrorNoBlocklist) {
+			Fail(c, http.StatusInternalServerError, "Blocklist is not configured!", err)
+			return
+		}
+		t.log.Error("failed to block destination", "error", err, "entry", req.Entry)
+		Fail(c, http.StatusInternalServerError, "Error blocking destination!", nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.BlockResponse{Entry: req.Entry, Disabled: n})
+}
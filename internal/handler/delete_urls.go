@@ -2,7 +2,6 @@ package handler
 
 import (
 	"encoding/json"
-	"io"
 	"net/http"
 	"url-shortener/internal/config"
 
@@ -10,38 +9,38 @@ import (
 )
 
 // @Summary Delete URLs
-// @Description Delete multiple URLs for a specific user
+// @Description Delete multiple URLs of a specific user on one domain
 // @Tags urls
 // @Accept json
 // @Produce plain
 // @Param Authorization header string true "Bearer JWT token"
+// @Param domain query string false "Branded domain of the links"
 // @Param request body []string true "Array of URLs to delete"
 // @Success 202 {string} string "Accepted"
-// @Failure 400 {string} string "Error reading body!/Error unmarshalling body!/Empty or malformed body sent!"
-// @Router /api/urls [delete]
+// @Failure 400 {object} models.Problem "Error reading body!/Error unmarshalling body!/Empty or malformed body sent!"
+// @Router /api/v1/user/urls [delete]
 func (t *Handler) DeleteURLs(c *gin.Context, cfg config.Config) {
 	var req []string
 
-	body, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.String(http.StatusBadRequest, "Error reading body!")
+	body, ok := ReadBody(c, "Error reading body!")
+	if !ok {
 		return
 	}
 
-	err = json.Unmarshal(body, &req)
+	err := json.Unmarshal(body, &req)
 	if err != nil {
-		c.String(http.StatusBadRequest, "Error unmarshalling body!")
+		Fail(c, http.StatusBadRequest, "Error unmarshalling body!", errorBody)
 		return
 	}
 
 	if len(req) == 0 {
-		c.String(http.StatusBadRequest, "Empty or malformed body sent!")
+		Fail(c, http.StatusBadRequest, "Empty or malformed body sent!", errorBody)
 		return
 	}
 
 	userID := c.GetString("user_id")
 
-	go t.service.DeleteURLs(req, userID)
+	go t.service.DeleteURLs(req, userID, linkDomain(c))
 
 	c.Status(http.StatusAccepted)
 }
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"url-shortener/internal/config"
+	"url-shortener/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Set default short domain
+// @Description Chooses the branded domain new links of the user are created on, "" for the default one
+// @Tags urls
+// @Accept json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param request body models.DomainRequest true "Default domain"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} models.Problem "Error reading body!/Error unmarshalling body!/Unknown domain!"
+// @Router /api/v1/user/domain [put]
+func (t *Handler) SetDefaultDomain(c *gin.Context, cfg config.Config) {
+	var req models.DomainRequest
+
+	body, ok := ReadBody(c, "Error reading body!")
+	if !ok {
+		return
+	}
+
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		Fail(c, http.StatusBadRequest, "Error unmarshalling body!", errorBody)
+		return
+	}
+
+	domain := strings.ToLower(req.Domain)
+	if !cfg.HasDomain(domain) {
+		Fail(c, http.StatusBadRequest, "Unknown domain!", errorUnknownDomain)
+		return
+	}
+
+	err = t.service.SetDefaultDomain(c.Request.Context(), c.GetString("user_id"), domain)
+	if err != nil {
+		Fail(c, http.StatusInternalServerError, "Error saving domain!", nil)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// createDomain picks the domain a new link is created on: the requested one or the
+// user's default. It returns false if the domain isn't configured.
+func (t *Handler) createDomain(c *gin.Context, cfg config.Config, requested string) (string, bool) {
+	domain := strings.ToLower(requested)
+	if domain == "" {
+		var err error
+		domain, err = t.service.DefaultDomain(c.Request.Context(), c.GetString("user_id"))
+		if err != nil {
+			t.log.Error("failed to load default domain", "error", err)
+			domain = ""
+		}
+	}
+	return domain, cfg.HasDomain(domain)
+}
+
+// linkDomain returns the domain of the link addressed by an API request: the domain
+// query parameter if present, otherwise the domain serving the request Host
+func linkDomain(c *gin.Context) string {
+	if domain, ok := c.GetQuery("domain"); ok {
+		return strings.ToLower(domain)
+	}
+	return c.GetString("domain")
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Export formats accepted by ExportURLs
+const (
+	exportCSV    = "csv"
+	exportJSON   = "json"
+	exportNDJSON = "ndjson"
+)
+
+// exportFlushEvery is the number of links written between flushes of the response
+const exportFlushEvery = 100
+
+// exportColumns is the CSV header of an export, starting with the columns read by ImportURLs
+var exportColumns = []string{"url", "alias", "tags", "expires_at", "domain", "short_url", "title", "description", "created_at", "deleted", "disabled", "clicks"}
+
+// exportWriter encodes exported links one at a time, writing nothing until the first link or close
+type exportWriter interface {
+	write(x models.ExportURL) error
+	close() error
+}
+
+// @Summary Export user's URLs
+// @Description Streams every link of the authenticated user, deleted ones included, with its settings, tags and total clicks.
+// @Description CSV exports can be imported again with POST /api/user/urls/import. Responses are gzip encoded when accepted.
+// @Tags urls
+// @Produce json,text/csv,application/x-ndjson
+// @Param Authorization header string true "Bearer JWT token"
+// @Param format query string false "json (default), csv or ndjson"
+// @Success 200 {array} models.ExportURL "User's links"
+// @Failure 400 {object} models.Problem "Unknown export format!/Error exporting URLs!"
+// @Router /api/v1/user/urls/export [get]
+func (t *Handler) ExportURLs(c *gin.Context, cfg config.Config) {
+	format := strings.ToLower(c.DefaultQuery("format", exportJSON))
+
+	var w exportWriter
+	switch format {
+	case exportCSV:
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w = &csvExport{w: csv.NewWriter(c.Writer)}
+	case exportJSON:
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		w = &jsonExport{w: c.Writer}
+	case exportNDJSON:
+		c.Header("Content-Type", "application/x-ndjson")
+		w = &ndjsonExport{enc: json.NewEncoder(c.Writer)}
+	default:
+		Fail(c, http.StatusBadRequest, "Unknown export format!", errorFormat)
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="urls.`+format+`"`)
+	c.Status(http.StatusOK)
+
+	n := 0
+	err := t.service.ExportURLs(c.Request.Context(), c.GetString("user_id"), func(x models.ExportURL) error {
+		x.ShortURL = cfg.ShortURL(x.Domain, x.ShortURL)
+		if err := w.write(x); err != nil {
+			return err
+		}
+		if n++; n%exportFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = w.close()
+	}
+
+	if err != nil {
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			Fail(c, http.StatusBadRequest, "Error exporting URLs!", nil)
+			return
+		}
+		t.log.Error("failed to export URLs", "error", err, "written", n)
+		c.Abort()
+	}
+}
+
+// jsonExport writes links as a single JSON array
+type jsonExport struct {
+	w       io.Writer
+	started bool
+}
+
+func (e *jsonExport) write(x models.ExportURL) error {
+	sep := ",\n"
+	if !e.started {
+		e.started, sep = true, "[\n"
+	}
+	b, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(e.w, sep+string(b))
+	return err
+}
+
+func (e *jsonExport) close() error {
+	end := "\n]\n"
+	if !e.started {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+// ndjsonExport writes one JSON object per line
+type ndjsonExport struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonExport) write(x models.ExportURL) error {
+	return e.enc.Encode(x)
+}
+
+func (e *ndjsonExport) close() error {
+	return nil
+}
+
+// csvExport writes links as CSV rows under exportColumns
+type csvExport struct {
+	w       *csv.Writer
+	started bool
+}
+
+func (e *csvExport) write(x models.ExportURL) error {
+	if err := e.header(); err != nil {
+		return err
+	}
+
+	// the short code is the last path segment of the short URL
+	alias := x.ShortURL[strings.LastIndex(x.ShortURL, "/")+1:]
+	var expiresAt string
+	if x.ExpiresAt != nil {
+		expiresAt = x.ExpiresAt.Format(time.RFC3339)
+	}
+	var createdAt string
+	if !x.CreatedAt.IsZero() {
+		createdAt = x.CreatedAt.Format(time.RFC3339)
+	}
+
+	err := e.w.Write([]string{
+		x.OriginalURL, alias, strings.Join(x.Tags, ";"), expiresAt, x.Domain, x.ShortURL,
+		x.Title, x.Description, createdAt,
+		strconv.FormatBool(x.Deleted), strconv.FormatBool(x.Disabled), strconv.Itoa(x.Clicks),
+	})
+	if err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExport) close() error {
+	if err := e.header(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// header writes the CSV header before the first row
+func (e *csvExport) header() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	return e.w.Write(exportColumns)
+}
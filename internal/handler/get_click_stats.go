@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"url-shortener/internal/config"
+	"url-shortener/internal/services"
+	"url-shortener/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Get link click analytics
+// @Description Returns the number of redirects of a user's link broken down by country
+// @Tags stats
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param id path string true "Shortened URL ID"
+// @Param domain query string false "Branded domain of the link"
+// @Success 200 {object} models.ClickStats "Click analytics"
+// @Failure 403 {object} models.Problem "URL belongs to another user!"
+// @Failure 404 {object} models.Problem "URL not found!"
+// @Failure 410 {object} models.Problem "URL was deleted!"
+// @Router /api/v1/user/urls/{id}/stats [get]
+func (t *Handler) GetClickStats(c *gin.Context, cfg config.Config) {
+	userID := c.GetString("user_id")
+
+	stats, err := t.service.GetClickStats(c.Request.Context(), userID, linkDomain(c), c.Param("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrorForbidden):
+			Fail(c, http.StatusForbidden, "URL belongs to another user!", services.ErrorForbidden)
+		case errors.Is(err, storage.ErrorURLDeleted):
+			Fail(c, http.StatusGone, "URL was deleted!", storage.ErrorURLDeleted)
+		case errors.Is(err, services.ErrorNotFound), errors.Is(err, storage.ErrorNotFound):
+			Fail(c, http.StatusNotFound, "URL not found!", services.ErrorNotFound)
+		default:
+			Fail(c, http.StatusInternalServerError, "Error loading stats!", nil)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
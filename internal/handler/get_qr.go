@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"url-shortener/internal/config"
+	"url-shortener/internal/models"
+	"url-shortener/internal/qrcode"
+	"url-shortener/internal/services"
+	"url-shortener/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Get QR code for a short URL
+// @Description Renders a QR code encoding the full short URL on the domain serving the request
+// @Tags qr
+// @Produce image/png,image/svg+xml
+// @Param id path string true "Shortened URL ID"
+// @Param format query string false "png (default) or svg"
+// @Param size query int false "Image size in pixels, 32-2048 (default 256)"
+// @Param margin query int false "Quiet zone in modules, 0-32 (default 4)"
+// @Param level query string false "Error correction level L, M (default), Q or H"
+// @Param fg query string false "Foreground hex color (default 000000)"
+// @Param bg query string false "Background hex color (default ffffff)"
+// @Success 200 {file} file "QR code image"
+// @Failure 400 {string} string "Invalid QR code options!"
+// @Failure 404 {string} string "URL not found!"
+// @Failure 410 {string} string "URL was deleted!"
+// @Router /{id}/qr [get]
+func (t *Handler) GetQR(c *gin.Context, cfg config.Config) {
+	rec, ok := t.qrRecord(c, c.GetString("domain"))
+	if !ok {
+		return
+	}
+	t.renderQR(c, cfg, rec)
+}
+
+// @Summary Get QR code for a user's short URL
+// @Description Renders a QR code encoding the full short URL of a link owned by the user
+// @Tags qr
+// @Produce image/png,image/svg+xml
+// @Param Authorization header string true "Bearer JWT token"
+// @Param id path string true "Shortened URL ID"
+// @Param domain query string false "Branded domain of the link"
+// @Param format query string false "png (default) or svg"
+// @Param size query int false "Image size in pixels, 32-2048 (default 256)"
+// @Param margin query int false "Quiet zone in modules, 0-32 (default 4)"
+// @Param level query string false "Error correction level L, M (default), Q or H"
+// @Param fg query string false "Foreground hex color (default 000000)"
+// @Param bg query string false "Background hex color (default ffffff)"
+// @Success 200 {file} file "QR code image"
+// @Failure 400 {object} models.Problem "Invalid QR code options!"
+// @Failure 403 {object} models.Problem "URL belongs to another user!"
+// @Failure 404 {object} models.Problem "URL not found!"
+// @Failure 410 {object} models.Problem "URL was deleted!"
+// @Router /api/v1/user/urls/{id}/qr [get]
+func (t *Handler) GetUserQR(c *gin.Context, cfg config.Config) {
+	rec, ok := t.qrRecord(c, linkDomain(c))
+	if !ok {
+		return
+	}
+
+	if rec.UserID != c.GetString("user_id") {
+		Fail(c, http.StatusForbidden, "URL belongs to another user!", services.ErrorForbidden)
+		return
+	}
+	t.renderQR(c, cfg, rec)
+}
+
+// qrRecord looks up the link a QR code is requested for and writes an error response if it is unavailable
+func (t *Handler) qrRecord(c *gin.Context, domain string) (models.URLRecord, bool) {
+	rec, err := t.service.GetURL(c.Request.Context(), domain, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, storage.ErrorURLDeleted) {
+			Fail(c, http.StatusGone, "URL was deleted!", storage.ErrorURLDeleted)
+			return rec, false
+		}
+		Fail(c, http.StatusNotFound, "URL not found!", services.ErrorNotFound)
+		return rec, false
+	}
+	return rec, true
+}
+
+// renderQR writes the QR code image for the link's full short URL
+func (t *Handler) renderQR(c *gin.Context, cfg config.Config, rec models.URLRecord) {
+	opts, err := qrOptions(c)
+	if err != nil {
+		Fail(c, http.StatusBadRequest, "Invalid QR code options!", errorQROptions)
+		return
+	}
+
+	var buf bytes.Buffer
+	err = qrcode.Render(&buf, cfg.ShortURL(rec.Domain, rec.ShortURL), opts)
+	if err != nil {
+		t.log.Error("failed to render QR code", "error", err, "id", rec.ShortURL)
+		Fail(c, http.StatusInternalServerError, "Can't render QR code!", nil)
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, opts.ContentType(), buf.Bytes())
+}
+
+// qrOptions reads QR code rendering options from the query string
+func qrOptions(c *gin.Context) (qrcode.Options, error) {
+	opts := qrcode.DefaultOptions()
+	var err error
+
+	if v := c.Query("format"); v != "" {
+		opts.Format = v
+	}
+	if v := c.Query("size"); v != "" {
+		if opts.Size, err = strconv.Atoi(v); err != nil {
+			return opts, err
+		}
+	}
+	if v := c.Query("margin"); v != "" {
+		if opts.Margin, err = strconv.Atoi(v); err != nil {
+			return opts, err
+		}
+	}
+	if v := c.Query("level"); v != "" {
+		if opts.Level, err = qrcode.ParseLevel(v); err != nil {
+			return opts, err
+		}
+	}
+	if v := c.Query("fg"); v != "" {
+		if opts.Foreground, err = qrcode.ParseColor(v); err != nil {
+			return opts, err
+		}
+	}
+	if v := c.Query("bg"); v != "" {
+		if opts.Background, err = qrcode.ParseColor(v); err != nil {
+			return opts, err
+		}
+	}
+	return opts, opts.Validate()
+}
@@ -15,40 +15,49 @@ import (
 // @Accept plain
 // @Produce plain
 // @Success 200 {string} string "Sucess"
-// @Failure 400 {string} string "Stats not found!"
-// @Failure 403 {string} string "Forbidden IP!"
-// @Router /api/internal/stats [get]
+// @Failure 400 {object} models.Problem "Stats not found!"
+// @Failure 403 {object} models.Problem "Forbidden IP!"
+// @Router /api/v1/internal/stats [get]
 func (t *Handler) GetStats(c *gin.Context, cfg config.Config) {
 	var res models.Stats
 
-	if cfg.TrustedSubnet == "" {
-		c.String(http.StatusForbidden, "No CIDR set!")
+	if !trustedIP(c, cfg) {
 		return
 	}
 
+	stats, err := t.service.GetStats(c.Request.Context())
+	if err != nil {
+		Fail(c, http.StatusBadRequest, "Stats not found!", nil)
+		return
+	}
+
+	res.Urls = stats.Urls
+	res.Users = stats.Users
+
+	c.JSON(http.StatusOK, res)
+}
+
+// trustedIP checks that the X-Real-IP of an internal request belongs to the trusted subnet,
+// responding with an error otherwise
+func trustedIP(c *gin.Context, cfg config.Config) bool {
+	if cfg.TrustedSubnet == "" {
+		Fail(c, http.StatusForbidden, "No CIDR set!", errorUntrusted)
+		return false
+	}
+
 	s := c.GetHeader("X-Real-IP")
 	userIP := net.ParseIP(s)
 
 	_, network, err := net.ParseCIDR(cfg.TrustedSubnet)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "Can't parse CIDR!")
-		return
+		Fail(c, http.StatusInternalServerError, "Can't parse CIDR!", nil)
+		return false
 	}
 
 	access := network.Contains(userIP)
 	if !access {
-		c.String(http.StatusForbidden, "IP address is not trusted!")
-		return
+		Fail(c, http.StatusForbidden, "IP address is not trusted!", errorUntrusted)
+		return false
 	}
-
-	stats, err := t.service.GetStats(c.Request.Context())
-	if err != nil {
-		c.String(http.StatusBadRequest, "Stats not found!")
-		return
-	}
-
-	res.Urls = stats.Urls
-	res.Users = stats.Users
-
-	c.JSON(http.StatusOK, res)
+	return true
 }
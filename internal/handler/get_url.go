@@ -1,43 +1,160 @@
 package handler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/models"
+	"url-shortener/internal/redirect"
+	"url-shortener/internal/services"
 	"url-shortener/internal/storage"
 
 	"github.com/gin-gonic/gin"
 )
 
 // @Summary Get original URL
-// @Description Retrieves and redirects to the original URL from a shortened URL ID
+// @Description Retrieves and redirects to the original URL from a shortened URL ID on the domain serving the request.
+// @Description Visitors matching one of the link's device, language, country or time rules are sent to the rule's destination.
+// @Description Links with A/B variants send each visitor to a weighted variant remembered in a cookie.
+// @Description Incoming query parameters are merged according to the link's query policy.
+// @Description Links disabled because their destination is blocked render a warning page.
+// @Description Destinations found on a threat list render a warning interstitial instead of redirecting.
+// @Description Link unfurling bots get a page with Open Graph and Twitter Card tags unless the link disables social cards.
+// @Description Appending "+" to the ID or passing preview=1 renders a preview page instead of redirecting.
 // @Tags urls
 // @Accept plain
-// @Produce plain
+// @Produce plain,html
 // @Param id path string true "Shortened URL ID"
+// @Param preview query bool false "Render a preview page"
+// @Success 200 {string} string "Preview page/Threat warning page/Social card"
 // @Success 307 {string} string "Temporary Redirect"
 // @Failure 400 {string} string "URL not found!"
-// @Failure 410 {string} string "URL was deleted!"
+// @Failure 403 {string} string "Link disabled warning page"
+// @Failure 410 {string} string "URL was deleted!/URL has expired!"
 // @Header 307 {string} Location "Original URL for redirect"
 // @Router /{id} [get]
 func (t *Handler) GetURL(c *gin.Context) {
 	id := c.Param("id")
 
+	preview := strings.HasSuffix(id, "+")
+	id = strings.TrimSuffix(id, "+")
+	if !preview {
+		preview, _ = strconv.ParseBool(c.Query("preview"))
+	}
+
 	if id != "" {
-		url, err := t.service.GetURL(c.Request.Context(), id)
+		rec, err := t.service.GetURL(c.Request.Context(), c.GetString("domain"), id)
 		if err != nil {
 			if errors.Is(err, storage.ErrorURLDeleted) {
-				c.String(http.StatusGone, "URL was deleted!")
+				Fail(c, http.StatusGone, "URL was deleted!", storage.ErrorURLDeleted)
 				return
 			}
-			c.String(http.StatusBadRequest, "URL not found!")
+			Fail(c, http.StatusBadRequest, "URL not found!", services.ErrorNotFound)
+			return
+		}
+
+		if rec.Expired(time.Now()) {
+			Fail(c, http.StatusGone, "URL has expired!", errorURLExpired)
+			return
+		}
+
+		if rec.Disabled {
+			t.renderPage(c, http.StatusForbidden, disabledPage, previewData{URL: rec.URL})
+			return
+		}
+
+		visit := newVisit(c)
+		visit.Country = t.service.Country(visit.IP)
+
+		cookie := variantCookie(rec.Domain, rec.ShortURL)
+		sticky, _ := c.Cookie(cookie)
+
+		if preview {
+			visit.RawQuery = ""
+			visit.Variant = sticky
+			url, _, err := redirect.Destination(rec, visit)
+			if err != nil {
+				url = rec.URL
+			}
+
+			t.renderPage(c, http.StatusOK, previewPage, previewData{
+				URL:         url,
+				Title:       rec.Title,
+				Description: rec.Description,
+				CreatedAt:   rec.CreatedAt,
+			})
+			return
+		}
+
+		visit.Variant = redirect.PickVariant(rec, sticky)
+
+		url, variant, err := redirect.Destination(rec, visit)
+		if err != nil {
+			t.log.Error("failed to build destination", "error", err, "id", id)
+			url = rec.URL
+		}
+
+		if threat := t.service.Threat(url); threat != "" {
+			t.renderPage(c, http.StatusOK, threatPage, threatData{URL: url, Threat: threat})
 			return
 		}
 
+		if c.GetBool("unfurler") && rec.CardEnabled() {
+			card := redirect.CardFor(rec)
+			t.renderPage(c, http.StatusOK, cardPage, cardData{
+				URL:         url,
+				Title:       card.Title,
+				Description: card.Description,
+				Image:       card.Image,
+			})
+			return
+		}
+
+		if variant != "" && variant != sticky {
+			c.SetCookie(cookie, variant, variantCookieAge, "/", "", false, true)
+		}
+
+		t.service.RecordClick(c.Request.Context(), models.Click{
+			Domain:   rec.Domain,
+			ShortURL: rec.ShortURL,
+			Time:     visit.Time,
+			Country:  visit.Country,
+			Variant:  variant,
+		})
+
 		c.Header("Location", url)
 		c.Redirect(http.StatusTemporaryRedirect, url)
+		metrics.Redirects.Inc()
 
 	} else {
-		c.String(http.StatusBadRequest, "URL is empty!")
+		Fail(c, http.StatusBadRequest, "URL is empty!", nil)
 		return
 	}
 }
+
+// variantCookieAge keeps A/B split visitors on the same variant for 30 days
+const variantCookieAge = 30 * 24 * 60 * 60
+
+// variantCookie returns the name of the cookie remembering a visitor's A/B variant of a link. Short codes
+// may be longer than browsers allow for cookie names and repeat across domains, so the name holds a hash.
+// The cookie is set for every path so that previews at "/{id}+" get it too.
+func variantCookie(domain, shortURL string) string {
+	sum := sha256.Sum256([]byte(domain + "/" + shortURL))
+	return "variant_" + hex.EncodeToString(sum[:8])
+}
+
+// newVisit collects the request details redirect rules are evaluated against
+func newVisit(c *gin.Context) models.Visit {
+	return models.Visit{
+		RawQuery:       c.Request.URL.RawQuery,
+		UserAgent:      c.Request.UserAgent(),
+		AcceptLanguage: c.GetHeader("Accept-Language"),
+		IP:             c.ClientIP(),
+		Time:           time.Now(),
+	}
+}
@@ -2,40 +2,64 @@ package handler
 
 import (
 	"net/http"
+	"slices"
 	"url-shortener/internal/config"
 	"url-shortener/internal/models"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Values of the health filter of GetUserURLs
+const (
+	healthBroken = "broken"
+	healthOK     = "ok"
+)
+
 // @Summary Get user's URLs
 // @Description Retrieves all URLs associated with the authenticated user
+// @Description The health filter selects links whose destination was last found broken or ok by the health checker
 // @Tags urls
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer JWT token"
+// @Param health query string false "Destination health filter: broken or ok"
 // @Success 200 {array} models.UserURLResponse "List of user's URLs"
 // @Success 204 {string} string "No URLs found!"
-// @Failure 400 {string} string "Error finding URLs!"
-// @Router /api/user/urls [get]
+// @Failure 400 {object} models.Problem "Error finding URLs!/Unknown health filter!"
+// @Router /api/v1/user/urls [get]
 func (t *Handler) GetUserURLs(c *gin.Context, cfg config.Config) {
 	var res []models.UserURLResponse
 
 	userID := c.GetString("user_id")
 
+	filter := c.Query("health")
+	if filter != "" && filter != healthBroken && filter != healthOK {
+		Fail(c, http.StatusBadRequest, "Unknown health filter!", nil)
+		return
+	}
+
 	err := t.service.GetUserURLs(c.Request.Context(), userID, &res)
 	if err != nil {
-		c.String(http.StatusBadRequest, "Error finding URLs!")
+		Fail(c, http.StatusBadRequest, "Error finding URLs!", nil)
 		return
 	}
 
+	if filter != "" {
+		res = slices.DeleteFunc(res, func(u models.UserURLResponse) bool {
+			if filter == healthBroken {
+				return !u.Health.Broken()
+			}
+			return u.Health == nil || u.Health.Broken()
+		})
+	}
+
 	if len(res) == 0 {
 		c.String(http.StatusNoContent, "No URLs found!")
 		return
 	}
 
 	for i := range res {
-		res[i].ShortURL = cfg.BaseURL + "/" + res[i].ShortURL
+		res[i].ShortURL = cfg.ShortURL(res[i].Domain, res[i].ShortURL)
 	}
 
 	c.JSON(http.StatusOK, res)
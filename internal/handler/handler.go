@@ -8,13 +8,25 @@ import (
 
 // Service defines the interface for URL shortening operations
 type Service interface {
-	SaveURL(ctx context.Context, url, userID string) (string, error)
-	GetURL(ctx context.Context, shortURL string) (string, error)
+	SaveURL(ctx context.Context, url, userID, domain string) (string, error)
+	GetURL(ctx context.Context, domain, shortURL string) (models.URLRecord, error)
+	UpdateURL(ctx context.Context, userID, domain, shortURL string, req models.UpdateURLRequest) (models.URLRecord, error)
 	ShortenBatch(ctx context.Context, userID string, req []models.BatchUnitURLRequest, res *[]models.BatchUnitURLResponse) error
+	ShortenEach(ctx context.Context, userID string, req []models.BatchUnitURLRequest) []models.BatchUnitURLResponse
 	GetUserURLs(ctx context.Context, userID string, res *[]models.UserURLResponse) error
 	PingDB() bool
-	DeleteURLs(req []string, userID string) error
+	DeleteURLs(req []string, userID, domain string) error
 	GetStats(ctx context.Context) (models.Stats, error)
+	Country(ip string) string
+	RecordClick(ctx context.Context, click models.Click)
+	GetClickStats(ctx context.Context, userID, domain, shortURL string) (models.ClickStats, error)
+	DefaultDomain(ctx context.Context, userID string) (string, error)
+	SetDefaultDomain(ctx context.Context, userID, domain string) error
+	Block(ctx context.Context, entry string) (int, error)
+	Threat(url string) string
+	ExpandURL(ctx context.Context, url string) (string, error)
+	ImportURL(ctx context.Context, userID string, row models.ImportRow) (models.URLRecord, bool, error)
+	ExportURLs(ctx context.Context, userID string, fn func(models.ExportURL) error) error
 }
 
 // Handler manages HTTP request handling for URL shortening service
@@ -2,10 +2,16 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http/httptest"
+	"os"
+	"strconv"
 	"testing"
+	"time"
+	"url-shortener/internal/config"
 	"url-shortener/internal/models"
+	"url-shortener/internal/storage"
 
 	"github.com/brianvoe/gofakeit/v7"
 	"github.com/gin-gonic/gin"
@@ -81,3 +87,91 @@ func BenchmarkShortenBatch(b *testing.B) {
 		h.ShortenBatch(c, cfg)
 	}
 }
+
+// batchBody builds a batch request of n new URLs
+func batchBody(n int) []byte {
+	req := make([]models.BatchUnitURLRequest, n)
+	for i := range req {
+		req[i] = models.BatchUnitURLRequest{ID: strconv.Itoa(i), URL: gofakeit.URL() + "/" + gofakeit.UUID()}
+	}
+	body, _ := json.Marshal(req)
+	return body
+}
+
+func BenchmarkShortenBatchLarge(b *testing.B) {
+	_, _, h, cfg := setupTest(&testing.T{})
+	defer os.Remove(cfg.StoragePath)
+	userID := gofakeit.UUID()
+
+	for _, query := range []string{"", "?atomic=true"} {
+		b.Run("atomic="+strconv.FormatBool(query != ""), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				body := batchBody(1000)
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				c.Request = httptest.NewRequest("POST", "/api/shorten/batch"+query, bytes.NewBuffer(body))
+				c.Set("user_id", userID)
+				b.StartTimer()
+
+				h.ShortenBatch(c, cfg)
+			}
+		})
+	}
+}
+
+// BenchmarkInsertBatch compares bulk inserts with one INSERT per record. It needs DATABASE_DSN.
+func BenchmarkInsertBatch(b *testing.B) {
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		b.Skip("DATABASE_DSN is not set")
+	}
+
+	cfg := config.Config{StoragePath: b.TempDir() + "/storage.json", DBAddress: dsn}
+	store, err := storage.New(context.Background(), &cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer store.DB.Close()
+
+	records := func(n int) []models.URLRecord {
+		recs := make([]models.URLRecord, n)
+		for i := range recs {
+			url := gofakeit.URL() + "/" + gofakeit.UUID()
+			recs[i] = models.URLRecord{UserID: "bench", ShortURL: gofakeit.UUID(), URL: url, Canonical: url, Domain: "bench.local", CreatedAt: time.Now().UTC()}
+		}
+		return recs
+	}
+
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run("bulk/"+strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				recs := records(n)
+				b.StartTimer()
+
+				if _, err := store.InsertBatch(context.Background(), store.DB, recs); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run("rows/"+strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				recs := records(n)
+				b.StartTimer()
+
+				for _, rec := range recs {
+					if err := store.Save(context.Background(), rec); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+
+	if _, err := store.DB.Exec("DELETE FROM urls WHERE domain = 'bench.local'"); err != nil {
+		b.Fatal(err)
+	}
+}
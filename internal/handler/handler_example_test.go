@@ -49,7 +49,7 @@ func ExampleHandler_ShortenBatch() {
 		{ID: "2", URL: "https://docs.soliditylang.org"},
 	}
 	body, _ := json.Marshal(req)
-	c.Request = httptest.NewRequest("POST", "/api/shorten/batch", bytes.NewBuffer(body))
+	c.Request = httptest.NewRequest("POST", "/api/shorten/batch?atomic=true", bytes.NewBuffer(body))
 	c.Set("user_id", "test-user")
 	h.ShortenBatch(c, cfg)
 
@@ -3,21 +3,44 @@ package handler
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"image/png"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"url-shortener/internal/blocklist"
 	"url-shortener/internal/config"
+	"url-shortener/internal/health"
 	"url-shortener/internal/logger"
+	"url-shortener/internal/metadata"
+	"url-shortener/internal/metrics"
 	"url-shortener/internal/models"
+	"url-shortener/internal/netguard"
 	"url-shortener/internal/services"
 	"url-shortener/internal/storage"
+	"url-shortener/internal/threatlist"
+	"url-shortener/internal/tracing"
+	"url-shortener/internal/unshorten"
 
 	"github.com/brianvoe/gofakeit/v7"
+	"github.com/deatil/go-encoding/base62"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func setupTest(t *testing.T) (*gin.Context, *httptest.ResponseRecorder, *Handler, config.Config) {
@@ -151,3 +174,1631 @@ func TestShortenBatch(t *testing.T) {
 
 	os.Remove(cfg.StoragePath)
 }
+
+func TestUpdateURLQueryPolicy(t *testing.T) {
+	c, w, h, cfg := setupTest(t)
+
+	userID := gofakeit.UUID()
+	originalURL := gofakeit.URL() + "/landing?ref=a&utm_source=own#top"
+
+	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(originalURL))
+	c.Set("user_id", userID)
+	h.PostURL(c, cfg)
+	require.Equal(t, http.StatusCreated, w.Code)
+	shortID := w.Body.String()[len(cfg.BaseURL)+1:]
+
+	patch := func(user, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("PATCH", "/api/user/urls/"+shortID, bytes.NewBufferString(body))
+		c.Params = []gin.Param{{Key: "id", Value: shortID}}
+		c.Set("user_id", user)
+		h.UpdateURL(c, cfg)
+		return w
+	}
+	redirect := func(rawQuery string) string {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/"+shortID+"?"+rawQuery, nil)
+		c.Params = []gin.Param{{Key: "id", Value: shortID}}
+		h.GetURL(c)
+		require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		return w.Header().Get("Location")
+	}
+
+	assert.Equal(t, originalURL, redirect("ref=b"))
+
+	w = patch(gofakeit.UUID(), `{"query_policy":"append"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = patch(userID, `{"query_policy":"merge"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = patch(userID, `{"query_policy":"append","utm":{"source":"mail","campaign":"spring sale"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, originalURL[:len(originalURL)-4]+"&ref=b&utm_campaign=spring+sale#top", redirect("ref=b"))
+
+	w = patch(userID, `{"query_policy":"override","utm":{}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, originalURL[:strings.Index(originalURL, "?")]+"?utm_source=own&ref=b%26c#top", redirect("ref=b%26c"))
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestGetURLPreview(t *testing.T) {
+	c, w, h, cfg := setupTest(t)
+
+	userID := gofakeit.UUID()
+	originalURL := gofakeit.URL()
+
+	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(originalURL))
+	c.Set("user_id", userID)
+	h.PostURL(c, cfg)
+	require.Equal(t, http.StatusCreated, w.Code)
+	shortID := w.Body.String()[len(cfg.BaseURL)+1:]
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("PATCH", "/api/user/urls/"+shortID, bytes.NewBufferString(`{"description":"Spring <sale> details"}`))
+	c.Params = []gin.Param{{Key: "id", Value: shortID}}
+	c.Set("user_id", userID)
+	h.UpdateURL(c, cfg)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	for _, tc := range []struct {
+		id    string
+		query string
+	}{
+		{id: shortID + "+"},
+		{id: shortID, query: "?preview=1"},
+	} {
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/"+tc.id+tc.query, nil)
+		c.Params = []gin.Param{{Key: "id", Value: tc.id}}
+		h.GetURL(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+		assert.Empty(t, w.Header().Get("Location"))
+		assert.Contains(t, w.Body.String(), originalURL)
+		assert.Contains(t, w.Body.String(), "Spring &lt;sale&gt; details")
+		assert.Contains(t, w.Body.String(), "Created on")
+	}
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestGetQR(t *testing.T) {
+	c, w, h, cfg := setupTest(t)
+
+	userID := gofakeit.UUID()
+	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(gofakeit.URL()))
+	c.Set("user_id", userID)
+	h.PostURL(c, cfg)
+	require.Equal(t, http.StatusCreated, w.Code)
+	shortID := w.Body.String()[len(cfg.BaseURL)+1:]
+
+	qr := func(user, query string, handle func(*gin.Context, config.Config)) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/"+shortID+"/qr?"+query, nil)
+		c.Params = []gin.Param{{Key: "id", Value: shortID}}
+		c.Set("user_id", user)
+		handle(c, cfg)
+		return w
+	}
+
+	w = qr("", "size=300&margin=2&fg=%23112233&bg=fff", h.GetQR)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	img, err := png.Decode(w.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 300, img.Bounds().Dx())
+	assert.Equal(t, 300, img.Bounds().Dy())
+
+	w = qr(userID, "format=svg&level=H", h.GetUserQR)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<svg")
+
+	w = qr(gofakeit.UUID(), "", h.GetUserQR)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	for _, query := range []string{"format=gif", "size=10", "margin=-1", "level=X", "fg=zzzzzz"} {
+		w = qr("", query, h.GetQR)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestGetURLRules(t *testing.T) {
+	c, w, h, cfg := setupTest(t)
+
+	userID := gofakeit.UUID()
+	originalURL := gofakeit.URL()
+
+	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(originalURL))
+	c.Set("user_id", userID)
+	h.PostURL(c, cfg)
+	require.Equal(t, http.StatusCreated, w.Code)
+	shortID := w.Body.String()[len(cfg.BaseURL)+1:]
+
+	patch := func(body string) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("PATCH", "/api/user/urls/"+shortID, bytes.NewBufferString(body))
+		c.Params = []gin.Param{{Key: "id", Value: shortID}}
+		c.Set("user_id", userID)
+		h.UpdateURL(c, cfg)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, patch(`{"rules":[{"url":"https://apps.apple.com/app"}]}`))
+	assert.Equal(t, http.StatusBadRequest, patch(`{"rules":[{"os":["symbian"],"url":"https://example.com"}]}`))
+	assert.Equal(t, http.StatusBadRequest, patch(`{"rules":[{"from":"25:00","url":"https://example.com"}]}`))
+	assert.Equal(t, http.StatusOK, patch(`{"rules":[
+		{"os":["ios"],"url":"https://apps.apple.com/app"},
+		{"os":["android"],"device":["mobile","tablet"],"url":"https://play.google.com/store/apps"},
+		{"os":["chromeos"],"url":"https://example.com/chromebook"},
+		{"language":["de"],"from":"00:00","to":"00:00","url":"https://example.de/never"},
+		{"language":["de"],"url":"https://example.de"}
+	]}`))
+
+	for _, tc := range []struct {
+		userAgent string
+		language  string
+		want      string
+	}{
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148", "", "https://apps.apple.com/app"},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36", "", "https://play.google.com/store/apps"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0", "de-AT,de;q=0.9,en;q=0.8", "https://example.de"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0", "en-US,de;q=0.9", originalURL},
+		{"Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 Chrome/120.0", "", "https://example.com/chromebook"},
+		{"Microsoft Office/16.0 (Macintosh; Mac OS X 14.2; Microsoft Outlook 16.80.1)", "", originalURL},
+	} {
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/"+shortID, nil)
+		c.Request.Header.Set("User-Agent", tc.userAgent)
+		c.Request.Header.Set("Accept-Language", tc.language)
+		c.Params = []gin.Param{{Key: "id", Value: shortID}}
+		h.GetURL(c)
+
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, tc.want, w.Header().Get("Location"), tc.userAgent)
+	}
+
+	os.Remove(cfg.StoragePath)
+}
+
+type fakeLocator map[string]string
+
+func (l fakeLocator) Country(ip net.IP) string {
+	return l[ip.String()]
+}
+
+func TestGetURLCountryRules(t *testing.T) {
+	c, w, h, cfg := setupTest(t)
+	h.service.(*services.URLs).Geo = fakeLocator{"203.0.113.7": "DE", "198.51.100.1": "US"}
+
+	userID := gofakeit.UUID()
+	originalURL := gofakeit.URL()
+
+	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(originalURL))
+	c.Set("user_id", userID)
+	h.PostURL(c, cfg)
+	require.Equal(t, http.StatusCreated, w.Code)
+	shortID := w.Body.String()[len(cfg.BaseURL)+1:]
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("PATCH", "/api/user/urls/"+shortID, bytes.NewBufferString(`{"rules":[{"country":["de","AT"],"url":"https://example.de"}]}`))
+	c.Params = []gin.Param{{Key: "id", Value: shortID}}
+	c.Set("user_id", userID)
+	h.UpdateURL(c, cfg)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	for ip, want := range map[string]string{
+		"203.0.113.7":  "https://example.de",
+		"198.51.100.1": originalURL,
+		"192.0.2.10":   originalURL,
+	} {
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/"+shortID, nil)
+		c.Request.RemoteAddr = ip + ":41000"
+		c.Params = []gin.Param{{Key: "id", Value: shortID}}
+		h.GetURL(c)
+
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, want, w.Header().Get("Location"), ip)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/user/urls/"+shortID+"/stats", nil)
+	c.Params = []gin.Param{{Key: "id", Value: shortID}}
+	c.Set("user_id", userID)
+	h.GetClickStats(c, cfg)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var stats models.ClickStats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, 3, stats.Clicks)
+	assert.Equal(t, map[string]int{"DE": 1, "US": 1}, stats.Countries)
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestGetURLVariants(t *testing.T) {
+	c, w, h, cfg := setupTest(t)
+
+	userID := gofakeit.UUID()
+	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(gofakeit.URL()))
+	c.Set("user_id", userID)
+	h.PostURL(c, cfg)
+	require.Equal(t, http.StatusCreated, w.Code)
+	shortID := w.Body.String()[len(cfg.BaseURL)+1:]
+	rec, err := h.service.GetURL(context.Background(), "", shortID)
+	require.NoError(t, err)
+	cookieName := variantCookie(rec.Domain, shortID)
+	assert.NotEqual(t, cookieName, variantCookie("go.example.com", shortID))
+
+	patch := func(body string) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("PATCH", "/api/user/urls/"+shortID, bytes.NewBufferString(body))
+		c.Params = []gin.Param{{Key: "id", Value: shortID}}
+		c.Set("user_id", userID)
+		h.UpdateURL(c, cfg)
+		return w.Code
+	}
+	visit := func(cookie string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/"+shortID, nil)
+		if cookie != "" {
+			c.Request.AddCookie(&http.Cookie{Name: cookieName, Value: cookie})
+		}
+		c.Params = []gin.Param{{Key: "id", Value: shortID}}
+		h.GetURL(c)
+		require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, patch(`{"variants":[{"id":"a","url":"https://a.example.com","weight":1},{"id":"a","url":"https://b.example.com","weight":1}]}`))
+	assert.Equal(t, http.StatusBadRequest, patch(`{"variants":[{"id":"a","url":"https://a.example.com","weight":0}]}`))
+	assert.Equal(t, http.StatusBadRequest, patch(`{"winner":"c"}`))
+	assert.Equal(t, http.StatusOK, patch(`{"variants":[{"id":"a","url":"https://a.example.com","weight":1},{"id":"b","url":"https://b.example.com","weight":0}]}`))
+
+	w = visit("")
+	assert.Equal(t, "https://a.example.com", w.Header().Get("Location"))
+	assert.Contains(t, w.Header().Get("Set-Cookie"), cookieName+"=a")
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "Path=/;")
+
+	w = visit("a")
+	assert.Equal(t, "https://a.example.com", w.Header().Get("Location"))
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+
+	w = visit("b")
+	assert.Equal(t, "https://a.example.com", w.Header().Get("Location"))
+
+	assert.Equal(t, http.StatusOK, patch(`{"winner":"b"}`))
+	w = visit("a")
+	assert.Equal(t, "https://b.example.com", w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/user/urls/"+shortID+"/stats", nil)
+	c.Params = []gin.Param{{Key: "id", Value: shortID}}
+	c.Set("user_id", userID)
+	h.GetClickStats(c, cfg)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var stats models.ClickStats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, 4, stats.Clicks)
+	assert.Equal(t, map[string]int{"a": 3, "b": 1}, stats.Variants)
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestBrandedDomains(t *testing.T) {
+	c, w, h, cfg := setupTest(t)
+	cfg.Domains = "https://go.brand.com, https://brand.link/"
+	require.NoError(t, cfg.ParseDomains())
+	assert.ErrorIs(t, (&config.Config{Domains: "https://brand.link, go.brand.com"}).ParseDomains(), config.ErrorDomain)
+
+	userID := gofakeit.UUID()
+	originalURL := gofakeit.URL()
+
+	body, _ := json.Marshal(models.ShortenURLRequest{URL: originalURL, Domain: "go.brand.com"})
+	c.Request = httptest.NewRequest("POST", "/api/shorten", bytes.NewBuffer(body))
+	c.Set("user_id", userID)
+	h.ShortenURL(c, cfg)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var res models.ShortenURLResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	require.True(t, strings.HasPrefix(res.Result, "https://go.brand.com/"))
+	shortID := strings.TrimPrefix(res.Result, "https://go.brand.com/")
+
+	get := func(domain string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/"+shortID, nil)
+		c.Params = []gin.Param{{Key: "id", Value: shortID}}
+		c.Set("domain", domain)
+		h.GetURL(c)
+		return w
+	}
+
+	w = get("go.brand.com")
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, originalURL, w.Header().Get("Location"))
+	assert.Equal(t, http.StatusBadRequest, get("").Code)
+	assert.Equal(t, http.StatusBadRequest, get("brand.link").Code)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	body, _ = json.Marshal(models.ShortenURLRequest{URL: gofakeit.URL(), Domain: "unknown.example"})
+	c.Request = httptest.NewRequest("POST", "/api/shorten", bytes.NewBuffer(body))
+	c.Set("user_id", userID)
+	h.ShortenURL(c, cfg)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("PUT", "/api/user/domain", bytes.NewBufferString(`{"domain":"brand.link"}`))
+	c.Set("user_id", userID)
+	h.SetDefaultDomain(c, cfg)
+	require.Equal(t, http.StatusNoContent, c.Writer.Status())
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(originalURL))
+	c.Set("user_id", userID)
+	h.PostURL(c, cfg)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "https://brand.link/"+shortID, w.Body.String())
+
+	batch, _ := json.Marshal([]models.BatchUnitURLRequest{
+		{ID: "1", URL: gofakeit.URL()},
+		{ID: "2", URL: gofakeit.URL(), Domain: "go.brand.com"},
+	})
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/shorten/batch", bytes.NewBuffer(batch))
+	c.Set("user_id", userID)
+	h.ShortenBatch(c, cfg)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var batchRes []models.BatchUnitURLResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &batchRes))
+	require.Len(t, batchRes, 2)
+	assert.True(t, strings.HasPrefix(batchRes[0].Short, "https://brand.link/"))
+	assert.True(t, strings.HasPrefix(batchRes[1].Short, "https://go.brand.com/"))
+
+	// the default domain survives reloading the file storage
+	store, err := storage.New(context.Background(), &cfg)
+	require.NoError(t, err)
+	domain, err := services.New(context.Background(), logger.New(), store).DefaultDomain(context.Background(), userID)
+	require.NoError(t, err)
+	assert.Equal(t, "brand.link", domain)
+	_, ok := store.URLs[storage.Key("brand.link", shortID)]
+	assert.True(t, ok)
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestPostURLCanonicalDedup(t *testing.T) {
+	_, _, h, cfg := setupTest(t)
+	h.service.(*services.URLs).Normalize.StripTracking = true
+
+	host := gofakeit.DomainName()
+	post := func(url string) string {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(url))
+		c.Set("user_id", "canonical-user")
+		h.PostURL(c, cfg)
+		require.Equal(t, http.StatusCreated, w.Code)
+		return w.Body.String()
+	}
+
+	exact := "https://" + strings.ToUpper(host) + "/a%7ez?b=2&a=1"
+	short := post(exact)
+	for _, url := range []string{
+		"https://" + host + "/a~z?a=1&b=2",
+		"https://" + host + ":443/a~z/?b=2&a=1",
+		"https://" + host + "/x/../a%7Ez?b=2&utm_source=mail&a=1&fbclid=abc",
+	} {
+		assert.Equal(t, short, post(url), url)
+	}
+	assert.NotEqual(t, short, post("http://"+host+"/a~z?a=1&b=2"))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	c.Params = []gin.Param{{Key: "id", Value: short[len(cfg.BaseURL)+1:]}}
+	h.GetURL(c)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, exact, w.Header().Get("Location"))
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestPostURLExistingCanonical(t *testing.T) {
+	host := gofakeit.DomainName()
+	legacy := "https://" + strings.ToUpper(host) + "/legacy"
+	legacyShort := base62.StdEncoding.EncodeToString([]byte(legacy))
+
+	// a record written before deduplication has no canonical URL and a short URL of the raw URL
+	cfg := config.Config{BaseURL: "http://localhost:8080", StoragePath: filepath.Join(t.TempDir(), "urls.json")}
+	line, err := json.Marshal(models.URLRecord{UserID: "legacy-user", ShortURL: legacyShort, URL: legacy})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(cfg.StoragePath, append(line, '\n'), 0644))
+
+	log := logger.New()
+	store, err := storage.New(context.Background(), &cfg)
+	require.NoError(t, err)
+	h := New(services.New(context.Background(), log, store), log)
+
+	post := func(url string) string {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(url))
+		c.Set("user_id", "canonical-user")
+		h.PostURL(c, cfg)
+		require.Equal(t, http.StatusCreated, w.Code)
+		return w.Body.String()
+	}
+	assert.Equal(t, cfg.BaseURL+"/"+legacyShort, post("https://"+host+"/legacy"))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/user/urls/import", bytes.NewBufferString("url,alias\nhttps://"+host+"/promo,promo\n"))
+	c.Request.Header.Set("Content-Type", "text/csv")
+	c.Set("user_id", "canonical-user")
+	h.ImportURLs(c, cfg)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, cfg.BaseURL+"/promo", post("https://"+strings.ToUpper(host)+"/promo"))
+
+	store.File.Close()
+}
+
+func TestBlocklist(t *testing.T) {
+	_, _, h, cfg := setupTest(t)
+	cfg.TrustedSubnet = "10.0.0.0/8"
+
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# phishing\nphish.example\n*.scam.example\nre:/login\\.php$\n"), 0644))
+	list, err := blocklist.Open(path)
+	require.NoError(t, err)
+	h.service.(*services.URLs).Blocklist = list
+
+	post := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(url))
+		c.Set("user_id", "blocklist-user")
+		h.PostURL(c, cfg)
+		return w
+	}
+
+	for _, url := range []string{
+		"https://phish.example/a",
+		"https://PHISH.example./a",
+		"https://www.scam.example/",
+		"https://bank.test/login.php",
+	} {
+		assert.Equal(t, http.StatusForbidden, post(url).Code, url)
+	}
+
+	host := gofakeit.DomainName()
+	w := post("https://" + host + "/offer")
+	require.Equal(t, http.StatusCreated, w.Code)
+	short := w.Body.String()[len(cfg.BaseURL)+1:]
+
+	block := func(ip, entry string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/internal/blocklist", bytes.NewBufferString(`{"entry":"`+entry+`"}`))
+		c.Request.Header.Set("X-Real-IP", ip)
+		h.BlockURL(c, cfg)
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, block("192.168.0.1", host).Code)
+	assert.Equal(t, http.StatusBadRequest, block("10.0.0.1", "https://"+host+"/").Code)
+
+	w = block("10.0.0.1", host)
+	require.Equal(t, http.StatusOK, w.Code)
+	var res models.BlockResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, 1, res.Disabled)
+
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/"+short, nil)
+	c.Params = []gin.Param{{Key: "id", Value: short}}
+	h.GetURL(c)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Link disabled")
+	assert.Empty(t, w.Header().Get("Location"))
+
+	reloaded, err := blocklist.Open(path)
+	require.NoError(t, err)
+	_, ok := reloaded.Blocked("https://" + host + "/other")
+	assert.True(t, ok)
+
+	os.Remove(cfg.StoragePath)
+}
+
+// threatUpdate builds a threat list update adding the 4 byte hash prefixes of the given expressions
+func threatUpdate(t *testing.T, responseType, state string, removals []int, exprs ...string) []byte {
+	t.Helper()
+
+	u := threatlist.ListUpdate{
+		ThreatType:      "SOCIAL_ENGINEERING",
+		PlatformType:    "ANY_PLATFORM",
+		ThreatEntryType: "URL",
+		ResponseType:    responseType,
+		NewClientState:  state,
+	}
+
+	var raw []byte
+	for _, expr := range exprs {
+		sum := sha256.Sum256([]byte(expr))
+		raw = append(raw, sum[:4]...)
+	}
+	if len(raw) > 0 {
+		u.Additions = []threatlist.ThreatEntrySet{{CompressionType: "RAW", RawHashes: &threatlist.RawHashes{PrefixSize: 4, RawHashes: raw}}}
+	}
+	if len(removals) > 0 {
+		u.Removals = []threatlist.ThreatEntrySet{{CompressionType: "RAW", RawIndices: &threatlist.RawIndices{Indices: removals}}}
+	}
+
+	b, err := json.Marshal(threatlist.UpdateResponse{ListUpdateResponses: []threatlist.ListUpdate{u}})
+	require.NoError(t, err)
+	return b
+}
+
+func TestThreatList(t *testing.T) {
+	_, _, h, cfg := setupTest(t)
+
+	dir := t.TempDir()
+	srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer srv.Close()
+	src := threatlist.HTTPSource{URL: srv.URL + "/update.json", Client: srv.Client()}
+
+	path := filepath.Join(t.TempDir(), "threats.json")
+	threats, err := threatlist.Open(path)
+	require.NoError(t, err)
+	h.service.(*services.URLs).Threats = threats
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "update.json"), threatUpdate(t, threatlist.FullUpdate, "1", nil, "evil.test/"), 0644))
+	require.NoError(t, threats.Update(context.Background(), src))
+
+	post := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(url))
+		c.Set("user_id", "threat-user")
+		h.PostURL(c, cfg)
+		return w
+	}
+	get := func(short string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/"+short, nil)
+		c.Params = []gin.Param{{Key: "id", Value: short}}
+		h.GetURL(c)
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, post("https://EVIL.test/login/form.html?next=1").Code)
+	assert.Equal(t, http.StatusForbidden, post("http://www.evil.test").Code)
+
+	host := gofakeit.DomainName()
+	w := post("https://" + host + "/landing")
+	require.Equal(t, http.StatusCreated, w.Code)
+	short := w.Body.String()[len(cfg.BaseURL)+1:]
+	assert.Equal(t, http.StatusTemporaryRedirect, get(short).Code)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "update.json"), threatUpdate(t, threatlist.PartialUpdate, "2", nil, host+"/landing"), 0644))
+	require.NoError(t, threats.Update(context.Background(), src))
+
+	w = get(short)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+	assert.Contains(t, w.Body.String(), "SOCIAL_ENGINEERING")
+	assert.Contains(t, w.Body.String(), "Continue anyway")
+
+	stored, err := threatlist.Open(path)
+	require.NoError(t, err)
+	_, ok := stored.Check("https://" + host + "/landing?utm_source=x")
+	assert.True(t, ok)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "update.json"), threatUpdate(t, threatlist.PartialUpdate, "3", []int{0, 1}), 0644))
+	require.NoError(t, threats.Update(context.Background(), src))
+	assert.Equal(t, http.StatusTemporaryRedirect, get(short).Code)
+	assert.Equal(t, http.StatusCreated, post("https://evil.test/").Code)
+
+	// an update file read again is skipped instead of removing prefixes twice
+	file := threatlist.FileSource{Path: filepath.Join(dir, "update.json")}
+	require.NoError(t, os.WriteFile(file.Path, threatUpdate(t, threatlist.PartialUpdate, "4", nil, "bad.test/", "worse.test/"), 0644))
+	require.NoError(t, threats.Update(context.Background(), file))
+	require.NoError(t, os.WriteFile(file.Path, threatUpdate(t, threatlist.PartialUpdate, "5", []int{0}), 0644))
+	require.NoError(t, threats.Update(context.Background(), file))
+	require.NoError(t, threats.Update(context.Background(), file))
+	_, bad := threats.Check("https://bad.test/")
+	_, worse := threats.Check("https://worse.test/")
+	assert.NotEqual(t, bad, worse)
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestThreatListFirstUpdate(t *testing.T) {
+	var requested struct {
+		ListUpdateRequests []threatlist.ListRequest `json:"listUpdateRequests"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&requested))
+		w.Write(threatUpdate(t, threatlist.FullUpdate, "1", nil, "evil.test/"))
+	}))
+	defer srv.Close()
+
+	_, err := threatlist.ParseLists([]string{"MALWARE/ANY_PLATFORM"})
+	assert.ErrorIs(t, err, threatlist.ErrorDescriptor)
+	lists, err := threatlist.ParseLists(threatlist.DefaultLists)
+	require.NoError(t, err)
+
+	// without a snapshot the configured lists seed the request
+	threats, err := threatlist.Open("")
+	require.NoError(t, err)
+	threats.Track(lists)
+	require.NoError(t, threats.Update(context.Background(), threatlist.HTTPSource{URL: srv.URL, Client: srv.Client()}))
+	assert.ElementsMatch(t, lists, requested.ListUpdateRequests)
+	_, ok := threats.Check("https://evil.test/")
+	assert.True(t, ok)
+
+	// and once stored, a list is requested with its state
+	require.NoError(t, threats.Update(context.Background(), threatlist.HTTPSource{URL: srv.URL, Client: srv.Client()}))
+	assert.Len(t, requested.ListUpdateRequests, 3)
+	assert.Contains(t, requested.ListUpdateRequests, threatlist.ListRequest{ThreatType: "SOCIAL_ENGINEERING", PlatformType: "ANY_PLATFORM", ThreatEntryType: "URL", State: "1"})
+}
+
+func TestPostURLRedirectChains(t *testing.T) {
+	_, _, h, cfg := setupTest(t)
+
+	post := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(url))
+		c.Set("user_id", "chain-user")
+		h.PostURL(c, cfg)
+		return w
+	}
+
+	w := post("https://" + gofakeit.DomainName() + "/a")
+	require.Equal(t, http.StatusCreated, w.Code)
+	short := w.Body.String()
+
+	w = post(short)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, short, w.Body.String())
+	assert.Equal(t, short, post(short+"+").Body.String())
+
+	for _, url := range []string{cfg.BaseURL + "/api/user/urls", cfg.BaseURL + "/missing", short + "/qr"} {
+		w = post(url)
+		assert.Equal(t, http.StatusBadRequest, w.Code, url)
+		assert.Equal(t, "URL points to this service!", w.Body.String())
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		switch r.URL.Path {
+		case "/s1":
+			http.Redirect(w, r, "/s2", http.StatusMovedPermanently)
+		case "/s2":
+			http.Redirect(w, r, short, http.StatusFound)
+		default:
+			http.Redirect(w, r, r.URL.Path+"/next", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+	h.service.(*services.URLs).Expander = unshorten.New(srv.Client(), []string{"127.0.0.1"})
+
+	w = post(srv.URL + "/s1")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, short, w.Body.String())
+
+	w = post(srv.URL + "/chain")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Redirect chain is too long!", w.Body.String())
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestGetUserURLsHealth(t *testing.T) {
+	_, _, h, cfg := setupTest(t)
+	svc := h.service.(*services.URLs)
+	// Only check the links created below
+	clear(svc.Storage.URLs)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gone":
+			w.WriteHeader(http.StatusNotFound)
+		case "/nohead":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	for _, url := range []string{srv.URL + "/ok", srv.URL + "/gone", srv.URL + "/nohead", down.URL + "/"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(url))
+		c.Set("user_id", "health-user")
+		h.PostURL(c, cfg)
+		require.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	svc.Checker = health.New(srv.Client(), 2, 10*time.Millisecond)
+	require.NoError(t, svc.CheckHealth(context.Background()))
+
+	list := func(filter string) (int, []models.UserURLResponse) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/api/user/urls?health="+filter, nil)
+		c.Set("user_id", "health-user")
+		h.GetUserURLs(c, cfg)
+
+		var res []models.UserURLResponse
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		}
+		return w.Code, res
+	}
+
+	code, res := list("broken")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, res, 2)
+	for _, u := range res {
+		require.NotNil(t, u.Health)
+		assert.False(t, u.Health.CheckedAt.IsZero())
+		if u.OriginalURL == srv.URL+"/gone" {
+			assert.Equal(t, http.StatusNotFound, u.Health.Status)
+		} else {
+			assert.Equal(t, down.URL+"/", u.OriginalURL)
+			assert.NotEmpty(t, u.Health.Error)
+		}
+	}
+
+	code, res = list("ok")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, res, 2)
+	for _, u := range res {
+		assert.Equal(t, http.StatusOK, u.Health.Status)
+	}
+
+	code, res = list("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, res, 4)
+
+	code, _ = list("dead")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestHealthCheckerHostDelay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// both names reach the same server but count as different hosts
+	other := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+	urls := []string{srv.URL + "/1", srv.URL + "/2", srv.URL + "/3", other + "/1"}
+
+	var mu sync.Mutex
+	var order []int
+	checker := health.New(srv.Client(), 1, 200*time.Millisecond)
+	checker.CheckAll(context.Background(), urls, func(i int, h models.Health) {
+		assert.Equal(t, http.StatusOK, h.Status, urls[i])
+		mu.Lock()
+		order = append(order, i)
+		mu.Unlock()
+	})
+
+	// the other host is checked while the first one waits out its delay, not after it
+	require.Len(t, order, 4)
+	assert.Less(t, slices.Index(order, 3), slices.Index(order, 1))
+	assert.Less(t, slices.Index(order, 1), slices.Index(order, 2))
+}
+
+func TestGetUserURLsMetadata(t *testing.T) {
+	_, _, h, cfg := setupTest(t)
+	svc := h.service.(*services.URLs)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<!DOCTYPE html><html><head>
+<title>  Spring
+ sale </title>
+<meta property="og:title" content="Spring sale">
+<meta property="og:description" content="Everything 20% off">
+<meta property="og:image" content="/img/sale.png">
+</head><body><meta property="og:title" content="ignored"></body></html>`))
+		case "/long":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><head><title>Long</title><!--" + strings.Repeat("x", 4096) + `--><meta property="og:title" content="too far"></head></html>`))
+		default:
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("\x89PNG"))
+		}
+	}))
+	defer srv.Close()
+
+	svc.Fetcher = metadata.New(srv.Client(), 1024, time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go svc.ProcessMetadata(ctx, 2)
+
+	for _, path := range []string{"/page", "/long", "/image.png"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(srv.URL+path))
+		c.Set("user_id", "metadata-user")
+		h.PostURL(c, cfg)
+		require.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	list := func() map[string]*models.Metadata {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/api/user/urls", nil)
+		c.Set("user_id", "metadata-user")
+		h.GetUserURLs(c, cfg)
+
+		var res []models.UserURLResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		meta := make(map[string]*models.Metadata)
+		for _, u := range res {
+			meta[strings.TrimPrefix(u.OriginalURL, srv.URL)] = u.Metadata
+		}
+		return meta
+	}
+
+	require.Eventually(t, func() bool {
+		meta := list()
+		return meta["/page"] != nil && meta["/long"] != nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	meta := list()
+	assert.Equal(t, "Spring sale", meta["/page"].Title)
+	assert.Equal(t, "Spring sale", meta["/page"].OGTitle)
+	assert.Equal(t, "Everything 20% off", meta["/page"].OGDescription)
+	assert.Equal(t, srv.URL+"/img/sale.png", meta["/page"].OGImage)
+	assert.False(t, meta["/page"].FetchedAt.IsZero())
+	assert.Equal(t, "Long", meta["/long"].Title)
+	assert.Empty(t, meta["/long"].OGTitle)
+	assert.Nil(t, meta["/image.png"])
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestFetchPrivateDestinations(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>Internal dashboard</title>"))
+	}))
+	defer srv.Close()
+
+	_, err := metadata.New(nil, 1024, time.Second).Fetch(context.Background(), srv.URL)
+	assert.ErrorIs(t, err, netguard.ErrorNotPublic)
+
+	h := health.New(nil, 1, 0).Check(context.Background(), srv.URL)
+	assert.Zero(t, h.Status)
+	assert.Contains(t, h.Error, netguard.ErrorNotPublic.Error())
+	assert.Zero(t, hits.Load())
+
+	for addr, public := range map[string]bool{
+		"127.0.0.1:80":          false,
+		"10.1.2.3:443":          false,
+		"169.254.169.254:80":    false,
+		"100.64.0.1:80":         false,
+		"0.0.0.0:80":            false,
+		"[::1]:80":              false,
+		"[fd00::1]:80":          false,
+		"[::ffff:10.0.0.1]:80":  false,
+		"93.184.215.14:443":     true,
+		"[2606:4700::6810]:443": true,
+	} {
+		err := netguard.Control("tcp", addr, nil)
+		assert.Equal(t, public, err == nil, addr)
+	}
+}
+
+func TestGetURLSocialCard(t *testing.T) {
+	c, w, h, cfg := setupTest(t)
+
+	userID := gofakeit.UUID()
+	originalURL := gofakeit.URL() + "/spring"
+
+	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(originalURL))
+	c.Set("user_id", userID)
+	h.PostURL(c, cfg)
+	require.Equal(t, http.StatusCreated, w.Code)
+	shortID := w.Body.String()[len(cfg.BaseURL)+1:]
+
+	patch := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("PATCH", "/api/user/urls/"+shortID, bytes.NewBufferString(body))
+		c.Params = []gin.Param{{Key: "id", Value: shortID}}
+		c.Set("user_id", userID)
+		h.UpdateURL(c, cfg)
+		return w
+	}
+	visit := func(bot bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/"+shortID, nil)
+		c.Params = []gin.Param{{Key: "id", Value: shortID}}
+		c.Set("unfurler", bot)
+		h.GetURL(c)
+		return w
+	}
+
+	w = visit(true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<meta property="og:title" content="`+originalURL+`">`)
+	assert.Contains(t, w.Body.String(), `<meta name="twitter:card" content="summary">`)
+
+	w = patch(`{"card":{"image":"ftp://example.com/a.png"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = patch(`{"card":{"title":"Spring sale","description":"Everything <20%> off","image":"https://example.com/a.png"}}`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = visit(true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `<meta property="og:title" content="Spring sale">`)
+	assert.Contains(t, body, `<meta property="og:description" content="Everything &lt;20%&gt; off">`)
+	assert.Contains(t, body, `<meta property="og:image" content="https://example.com/a.png">`)
+	assert.Contains(t, body, `<meta name="twitter:card" content="summary_large_image">`)
+	assert.Contains(t, body, `<meta property="og:url" content="`+originalURL+`">`)
+
+	w = visit(false)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, originalURL, w.Header().Get("Location"))
+
+	w = patch(`{"social_card":false}`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = visit(true)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, originalURL, w.Header().Get("Location"))
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestImportURLs(t *testing.T) {
+	_, _, h, cfg := setupTest(t)
+	userID := gofakeit.UUID()
+
+	post := func(contentType, body string) (*httptest.ResponseRecorder, models.ImportReport) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/user/urls/import", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", contentType)
+		c.Set("user_id", userID)
+		h.ImportURLs(c, cfg)
+
+		var report models.ImportReport
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		}
+		return w, report
+	}
+
+	first, second := gofakeit.URL()+"/first", gofakeit.URL()+"/second"
+	expiry := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	w, report := post("text/csv", "URL,alias,tags,expires_at\n"+
+		first+",,spring;mail,\n"+
+		second+",spring-sale,,"+expiry+"\n"+
+		"ftp://example.com/file,,,\n"+
+		gofakeit.URL()+",bad alias!,,\n"+
+		gofakeit.URL()+",Swagger,,\n"+
+		gofakeit.URL()+",,,2000-01-01\n"+
+		gofakeit.URL()+",,,tomorrow\n"+
+		first+",,,\n")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, 1, report.Existing)
+	assert.Equal(t, 5, report.Failed)
+	require.Len(t, report.Results, 8)
+	assert.Equal(t, models.ImportCreated, report.Results[0].Status)
+	assert.Equal(t, cfg.BaseURL+"/spring-sale", report.Results[1].ShortURL)
+	assert.Equal(t, "URL scheme must be one of http, https", report.Results[2].Error)
+	assert.Equal(t, services.ErrorInvalidAlias.Error(), report.Results[3].Error)
+	assert.Equal(t, services.ErrorReservedAlias.Error(), report.Results[4].Error)
+	assert.Equal(t, "expiry is in the past", report.Results[5].Error)
+	assert.Equal(t, "malformed expiry", report.Results[6].Error)
+	assert.Equal(t, models.ImportExisting, report.Results[7].Status)
+	assert.Equal(t, report.Results[0].ShortURL, report.Results[7].ShortURL)
+
+	w, report = post("application/x-ndjson", `{"url":"`+gofakeit.URL()+`","alias":"spring-sale"}`+"\n\n"+
+		`{"url":"`+second+`","alias":"spring-sale"}`+"\n"+
+		`{"url":`+"\n"+
+		`{"url":"`+gofakeit.URL()+`","tags":["a","a"," b "],"expires_at":"2100-01-01"}`+"\n")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, report.Results, 4)
+	assert.Equal(t, services.ErrorAliasTaken.Error(), report.Results[0].Error)
+	assert.Equal(t, models.ImportExisting, report.Results[1].Status)
+	assert.Equal(t, 4, report.Results[2].Row)
+	assert.Equal(t, "malformed JSON", report.Results[2].Error)
+	assert.Equal(t, models.ImportCreated, report.Results[3].Status)
+
+	rec, err := h.service.GetURL(context.Background(), "", "spring-sale")
+	require.NoError(t, err)
+	assert.Equal(t, second, rec.URL)
+	require.NotNil(t, rec.ExpiresAt)
+
+	rec, err = h.service.GetURL(context.Background(), "", report.Results[3].ShortURL[len(cfg.BaseURL)+1:])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, rec.Tags)
+
+	svc := h.service.(*services.URLs)
+	past := time.Now().Add(-time.Minute)
+	rec.ExpiresAt = &past
+	svc.Storage.URLs[storage.Key(rec.Domain, rec.ShortURL)] = rec
+
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/"+rec.ShortURL, nil)
+	c.Params = []gin.Param{{Key: "id", Value: rec.ShortURL}}
+	h.GetURL(c)
+	assert.Equal(t, http.StatusGone, w.Code)
+
+	w, _ = post("text/csv", "alias,tags\nx,y\n")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w, _ = post("application/xml", "<urls/>")
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestExportURLs(t *testing.T) {
+	_, _, h, cfg := setupTest(t)
+	svc := h.service.(*services.URLs)
+	svc.Storage.URLs = map[string]models.URLRecord{}
+	userID := gofakeit.UUID()
+
+	first, second := gofakeit.URL()+"/first", gofakeit.URL()+"/second"
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/user/urls/import", bytes.NewBufferString(
+		"url,alias,tags\n"+first+",first,a;b\n"+second+",second,\n"))
+	c.Request.Header.Set("Content-Type", "text/csv")
+	c.Set("user_id", userID)
+	h.ImportURLs(c, cfg)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	for range 2 {
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/first", nil)
+		c.Params = []gin.Param{{Key: "id", Value: "first"}}
+		h.GetURL(c)
+		require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	}
+
+	rec := svc.Storage.URLs["second"]
+	rec.Deleted = true
+	svc.Storage.URLs["second"] = rec
+
+	export := func(format, user string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/api/user/urls/export?format="+format, nil)
+		c.Set("user_id", user)
+		h.ExportURLs(c, cfg)
+		return w
+	}
+
+	w = export("json", userID)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `attachment; filename="urls.json"`, w.Header().Get("Content-Disposition"))
+	var res []models.ExportURL
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	require.Len(t, res, 2)
+	assert.Equal(t, cfg.BaseURL+"/first", res[0].ShortURL)
+	assert.Equal(t, 2, res[0].Clicks)
+	assert.Equal(t, []string{"a", "b"}, res[0].Tags)
+	assert.False(t, res[0].Deleted)
+	assert.True(t, res[1].Deleted)
+
+	w = export("ndjson", userID)
+	require.Equal(t, http.StatusOK, w.Code)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 2)
+	var x models.ExportURL
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &x))
+	assert.Equal(t, second, x.OriginalURL)
+
+	w = export("csv", userID)
+	require.Equal(t, http.StatusOK, w.Code)
+	lines = strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "url,alias,tags,expires_at,domain,short_url,"))
+	assert.True(t, strings.HasPrefix(lines[1], first+",first,a;b,,,"+cfg.BaseURL+"/first,"))
+	assert.True(t, strings.HasSuffix(lines[1], ",false,false,2"))
+	assert.True(t, strings.HasSuffix(lines[2], ",true,false,0"))
+
+	w = export("json", gofakeit.UUID())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[]\n", w.Body.String())
+
+	w = export("xml", userID)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	instance := func() (*Handler, config.Config) {
+		cfg := config.Config{BaseURL: "http://localhost:8080", StoragePath: filepath.Join(t.TempDir(), "urls.json")}
+		log := logger.New()
+		store, err := storage.New(context.Background(), &cfg)
+		require.NoError(t, err)
+		t.Cleanup(func() { store.File.Close() })
+		return New(services.New(context.Background(), log, store), log), cfg
+	}
+	userID := gofakeit.UUID()
+
+	// a URL long enough for a generated code over 64 characters, an alias and a deleted link
+	long := "https://" + gofakeit.DomainName() + "/spring/" + strings.Repeat("sale", 12) + "?ref=mail"
+	aliased, deleted := gofakeit.URL()+"/aliased", gofakeit.URL()+"/deleted"
+
+	src, cfg := instance()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(long))
+	c.Set("user_id", userID)
+	src.PostURL(c, cfg)
+	require.Equal(t, http.StatusCreated, w.Code)
+	longShort := w.Body.String()
+	require.Greater(t, len(longShort)-len(cfg.BaseURL)-1, 64)
+
+	importCSV := func(h *Handler, body string) models.ImportReport {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/user/urls/import", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "text/csv")
+		c.Set("user_id", userID)
+		h.ImportURLs(c, cfg)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var report models.ImportReport
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return report
+	}
+	report := importCSV(src, "url,alias\n"+aliased+",promo\n"+deleted+",gone\n")
+	require.Equal(t, 2, report.Created)
+
+	svc := src.service.(*services.URLs)
+	rec := svc.Storage.URLs["gone"]
+	rec.Deleted = true
+	svc.Storage.URLs["gone"] = rec
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/api/user/urls/export?format=csv", nil)
+	c.Set("user_id", userID)
+	src.ExportURLs(c, cfg)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	dst, _ := instance()
+	report = importCSV(dst, w.Body.String())
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Zero(t, report.Failed, report.Results)
+
+	for short, want := range map[string]string{longShort: long, cfg.BaseURL + "/promo": aliased, cfg.BaseURL + "/gone": ""} {
+		id := short[len(cfg.BaseURL)+1:]
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/"+id, nil)
+		c.Params = []gin.Param{{Key: "id", Value: id}}
+		dst.GetURL(c)
+		if want == "" {
+			assert.NotEqual(t, http.StatusTemporaryRedirect, w.Code, short)
+			continue
+		}
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code, short)
+		assert.Equal(t, want, w.Header().Get("Location"))
+	}
+}
+
+func TestShortenBatchPartial(t *testing.T) {
+	_, _, h, cfg := setupTest(t)
+
+	list, err := blocklist.Open("")
+	require.NoError(t, err)
+	require.NoError(t, list.Add("phish.example"))
+	h.service.(*services.URLs).Blocklist = list
+
+	batch := func(query string, req []models.BatchUnitURLRequest) (*httptest.ResponseRecorder, []models.BatchUnitURLResponse) {
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/shorten/batch"+query, bytes.NewBuffer(body))
+		c.Set("user_id", gofakeit.UUID())
+		h.ShortenBatch(c, cfg)
+
+		var res []models.BatchUnitURLResponse
+		if w.Code == http.StatusCreated || w.Code == http.StatusMultiStatus {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		}
+		return w, res
+	}
+
+	existing := gofakeit.URL()
+	w, res := batch("", []models.BatchUnitURLRequest{{ID: "1", URL: existing}})
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Len(t, res, 1)
+	assert.Equal(t, models.BatchCreated, res[0].Status)
+	short := res[0].Short
+
+	fresh := gofakeit.URL()
+	w, res = batch("", []models.BatchUnitURLRequest{
+		{ID: "a", URL: fresh},
+		{ID: "b", URL: existing},
+		{ID: "c", URL: "http://bad host/"},
+		{ID: "d", URL: "https://phish.example/login"},
+		{ID: "e", URL: gofakeit.URL(), Domain: "unknown.example"},
+		{ID: "f", URL: fresh},
+	})
+	require.Equal(t, http.StatusMultiStatus, w.Code)
+	require.Len(t, res, 6)
+	assert.Equal(t, models.BatchCreated, res[0].Status)
+	assert.Equal(t, models.BatchExisting, res[1].Status)
+	assert.Equal(t, short, res[1].Short)
+	assert.Equal(t, models.BatchInvalid, res[2].Status)
+	assert.Empty(t, res[2].Short)
+	assert.Equal(t, models.BatchBlocked, res[3].Status)
+	assert.Equal(t, models.BatchInvalid, res[4].Status)
+	assert.Equal(t, "unknown domain", res[4].Error)
+	assert.Equal(t, models.BatchExisting, res[5].Status)
+	assert.Equal(t, res[0].Short, res[5].Short)
+	for i, id := range []string{"a", "b", "c", "d", "e", "f"} {
+		assert.Equal(t, id, res[i].ID)
+	}
+
+	atomic := gofakeit.URL()
+	w, _ = batch("?atomic=true", []models.BatchUnitURLRequest{
+		{ID: "1", URL: atomic},
+		{ID: "2", URL: "https://phish.example/"},
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	rec, err := h.service.GetURL(context.Background(), "", res[0].Short[len(cfg.BaseURL)+1:])
+	require.NoError(t, err)
+	assert.Equal(t, fresh, rec.URL)
+
+	w, res = batch("", []models.BatchUnitURLRequest{{ID: "1", URL: atomic}})
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, models.BatchCreated, res[0].Status)
+
+	os.Remove(cfg.StoragePath)
+}
+
+// TestShortenEachDatabase checks the bulk insert reports the short URLs stored for conflicting items. It needs DATABASE_DSN.
+func TestShortenEachDatabase(t *testing.T) {
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("DATABASE_DSN is not set")
+	}
+
+	ctx := context.Background()
+	cfg := config.Config{StoragePath: filepath.Join(t.TempDir(), "storage.json"), DBAddress: dsn}
+	store, err := storage.New(ctx, &cfg)
+	require.NoError(t, err)
+	defer store.DB.Close()
+	svc := services.New(ctx, logger.New(), store)
+
+	domain := gofakeit.UUID() + ".test"
+	defer store.DB.Exec("DELETE FROM urls WHERE domain = $1", domain)
+
+	link := func(url, short string) models.URLRecord {
+		return models.URLRecord{UserID: "test", ShortURL: short, URL: url, Canonical: url, Domain: domain, CreatedAt: time.Now().UTC()}
+	}
+	code := func(url string) string {
+		return base62.StdEncoding.EncodeToString([]byte(url))
+	}
+
+	aliased := "https://example.com/aliased"
+	require.NoError(t, store.Save(ctx, link(aliased, "alias")))
+	deleted := "https://example.com/deleted"
+	require.NoError(t, store.Save(ctx, link(deleted, "gone")))
+	_, err = store.DB.Exec("UPDATE urls SET deleted = true WHERE domain = $1 AND short_url = 'gone'", domain)
+	require.NoError(t, err)
+	// a legacy link whose short URL is the code another destination would get
+	taken := "https://example.com/taken"
+	require.NoError(t, store.Save(ctx, link("https://example.com/legacy", code(taken))))
+
+	fresh := "https://example.com/fresh"
+	res := svc.ShortenEach(ctx, "test", []models.BatchUnitURLRequest{
+		{ID: "a", URL: fresh, Domain: domain},
+		{ID: "b", URL: aliased, Domain: domain},
+		{ID: "c", URL: deleted, Domain: domain},
+		{ID: "d", URL: taken, Domain: domain},
+		{ID: "e", URL: fresh, Domain: domain},
+	})
+	require.Len(t, res, 5)
+	assert.Equal(t, models.BatchCreated, res[0].Status)
+	assert.Equal(t, code(fresh), res[0].Short)
+	assert.Equal(t, models.BatchExisting, res[1].Status)
+	assert.Equal(t, "alias", res[1].Short)
+	assert.Equal(t, models.BatchExisting, res[2].Status)
+	assert.Equal(t, "gone", res[2].Short)
+	assert.Equal(t, models.BatchInvalid, res[3].Status)
+	assert.Equal(t, services.ErrorAliasTaken.Error(), res[3].Error)
+	assert.Empty(t, res[3].Short)
+	assert.Equal(t, models.BatchExisting, res[4].Status)
+	assert.Equal(t, code(fresh), res[4].Short)
+
+	results, err := store.InsertBatch(ctx, store.DB, []models.URLRecord{link(aliased, code(aliased)), link(taken, code(taken))})
+	require.NoError(t, err)
+	assert.Equal(t, []storage.BatchResult{{ShortURL: "alias"}, {}}, results)
+
+	err = store.SaveBatch(ctx, store.DB, []models.URLRecord{link("https://example.com/other", code("https://example.com/other")), link(aliased, code(aliased))})
+	assert.ErrorIs(t, err, storage.ErrorDuplicate)
+}
+
+func TestShortenBatchStream(t *testing.T) {
+	_, _, h, cfg := setupTest(t)
+	cfg.BatchMaxItems = 4
+
+	send := func(query, contentType, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/shorten/batch"+query, bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", contentType)
+		c.Set("user_id", gofakeit.UUID())
+		h.ShortenBatch(c, cfg)
+		return w
+	}
+
+	url := gofakeit.URL()
+	w := send("", "application/x-ndjson", `{"correlation_id":"1","original_url":"`+url+`"}`+"\n\n"+
+		`{"correlation_id":"2",`+"\n"+
+		`{"correlation_id":"3","original_url":"`+url+`"}`+"\n"+
+		`{"correlation_id":"4","original_url":"`+gofakeit.URL()+`"}`+"\n"+
+		`{"correlation_id":"5","original_url":"`+gofakeit.URL()+`"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	var res []models.BatchUnitURLResponse
+	for _, line := range strings.Split(strings.TrimSpace(w.Body.String()), "\n") {
+		var x models.BatchUnitURLResponse
+		require.NoError(t, json.Unmarshal([]byte(line), &x))
+		res = append(res, x)
+	}
+	require.Len(t, res, 5)
+	assert.Equal(t, "1", res[0].ID)
+	assert.Equal(t, models.BatchCreated, res[0].Status)
+	assert.Equal(t, "malformed JSON", res[1].Error)
+	assert.Equal(t, models.BatchExisting, res[2].Status)
+	assert.Equal(t, res[0].Short, res[2].Short)
+	assert.Equal(t, models.BatchCreated, res[3].Status)
+	assert.Equal(t, "batch is limited to 4 items", res[4].Error)
+
+	w = send("", "application/x-ndjson", "\n")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = send("?atomic=true", "application/x-ndjson", `{"correlation_id":"1","original_url":"`+url+`"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	items, _ := json.Marshal(make([]models.BatchUnitURLRequest, 5))
+	w = send("", "application/json", string(items))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestProblemErrors(t *testing.T) {
+	c, w, h, cfg := setupTest(t)
+
+	userID := gofakeit.UUID()
+	originalURL := gofakeit.URL()
+
+	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(originalURL))
+	c.Set("user_id", userID)
+	h.PostURL(c, cfg)
+	require.Equal(t, http.StatusCreated, w.Code)
+	shortID := w.Body.String()[len(cfg.BaseURL)+1:]
+
+	call := func(problem bool, method, body string, fn func(c *gin.Context)) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(method, "/api/v1/user/urls/"+shortID, bytes.NewBufferString(body))
+		c.Params = []gin.Param{{Key: "id", Value: shortID}}
+		c.Set("user_id", userID)
+		if problem {
+			c.Set("problem", true)
+		}
+		fn(c)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) models.Problem {
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+		var p models.Problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		return p
+	}
+
+	w = call(false, "PATCH", `{"query_policy":"merge"}`, func(c *gin.Context) { h.UpdateURL(c, cfg) })
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Invalid link settings!", w.Body.String())
+
+	w = call(true, "PATCH", `{"query_policy":"merge"}`, func(c *gin.Context) { h.UpdateURL(c, cfg) })
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	p := decode(w)
+	assert.Equal(t, "invalid_settings", p.Code)
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, "Bad Request", p.Title)
+	assert.Equal(t, "/api/v1/user/urls/"+shortID, p.Instance)
+
+	w = call(true, "PATCH", `{`, func(c *gin.Context) { h.UpdateURL(c, cfg) })
+	assert.Equal(t, "malformed_body", decode(w).Code)
+
+	w = call(true, "POST", `{}`, func(c *gin.Context) { h.ShortenURL(c, cfg) })
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "validation_failed", decode(w).Code)
+
+	w = call(true, "GET", "", func(c *gin.Context) {
+		c.Params = []gin.Param{{Key: "id", Value: "missing"}}
+		h.GetClickStats(c, cfg)
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "url_not_found", decode(w).Code)
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestCreateValidation(t *testing.T) {
+	_, _, h, cfg := setupTest(t)
+	cfg.MaxURLLength = 100
+	cfg.AllowedSchemes = "https"
+
+	call := func(target, body string, fn func(c *gin.Context)) (*httptest.ResponseRecorder, models.Problem) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", target, bytes.NewBufferString(body))
+		c.Request.Body = http.MaxBytesReader(w, c.Request.Body, 512)
+		c.Set("user_id", "validation-user")
+		fn(c)
+
+		var p models.Problem
+		if w.Header().Get("Content-Type") == "application/problem+json" {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		}
+		return w, p
+	}
+	shorten := func(c *gin.Context) { h.ShortenURL(c, cfg) }
+
+	w, p := call("/api/shorten", `{"url":"http://`+gofakeit.DomainName()+`/","domain":"nope.example"}`, shorten)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "validation_failed", p.Code)
+	assert.Equal(t, []models.FieldError{
+		{Field: "url", Code: "scheme_not_allowed", Message: "URL scheme must be one of https"},
+		{Field: "domain", Code: "unknown_domain", Message: "unknown domain"},
+	}, p.Errors)
+
+	w, p = call("/api/shorten", `{"url":"https://`+gofakeit.DomainName()+`/`+strings.Repeat("a", 100)+`"}`, shorten)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	require.Len(t, p.Errors, 1)
+	assert.Equal(t, "too_long", p.Errors[0].Code)
+
+	w, p = call("/", "not a url", func(c *gin.Context) { h.PostURL(c, cfg) })
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	require.Len(t, p.Errors, 1)
+	assert.Equal(t, models.FieldError{Field: "url", Code: "malformed", Message: "URL must be absolute"}, p.Errors[0])
+
+	w, p = call("/api/shorten/batch?atomic=true", `[{"correlation_id":"1","original_url":"https://`+gofakeit.DomainName()+`/"},`+
+		`{"correlation_id":"2","original_url":""}]`, func(c *gin.Context) { h.ShortenBatch(c, cfg) })
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []models.FieldError{{Field: "[1].original_url", Code: "required", Message: "URL is required"}}, p.Errors)
+
+	w, p = call("/api/shorten", `{"url":"https://`+gofakeit.DomainName()+`/`+strings.Repeat("a", 600)+`"}`, shorten)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Empty(t, p.Code)
+
+	w, _ = call("/api/shorten", `{"url":"https://`+gofakeit.DomainName()+`/"}`, shorten)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestMetrics(t *testing.T) {
+	c, w, h, cfg := setupTest(t)
+	created, redirects := testutil.ToFloat64(metrics.LinksCreated), testutil.ToFloat64(metrics.Redirects)
+
+	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(gofakeit.URL()))
+	c.Set("user_id", gofakeit.UUID())
+	h.PostURL(c, cfg)
+	require.Equal(t, http.StatusCreated, w.Code)
+	shortID := w.Body.String()[len(cfg.BaseURL)+1:]
+	assert.Equal(t, created+1, testutil.ToFloat64(metrics.LinksCreated))
+
+	for range 2 {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/"+shortID, nil)
+		c.Params = []gin.Param{{Key: "id", Value: shortID}}
+		h.GetURL(c)
+		require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	}
+	assert.Equal(t, redirects+2, testutil.ToFloat64(metrics.Redirects))
+
+	os.Remove(cfg.StoragePath)
+}
+
+func TestTracing(t *testing.T) {
+	c, w, h, cfg := setupTest(t)
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	_, err := tracing.Setup(context.Background(), tracing.ExporterNone)
+	require.NoError(t, err)
+
+	c.Request = httptest.NewRequest("POST", "/", bytes.NewBufferString(gofakeit.URL()))
+	c.Set("user_id", gofakeit.UUID())
+	h.PostURL(c, cfg)
+	require.Equal(t, http.StatusCreated, w.Code)
+	shortID := w.Body.String()[len(cfg.BaseURL)+1:]
+
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req := httptest.NewRequest("GET", "/"+shortID, nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = req.WithContext(otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header)))
+	c.Params = []gin.Param{{Key: "id", Value: shortID}}
+	h.GetURL(c)
+	require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	var span sdktrace.ReadOnlySpan
+	for _, s := range recorder.Ended() {
+		if s.Name() == "URLs.GetURL" {
+			span = s
+		}
+	}
+	require.NotNil(t, span)
+	assert.Equal(t, traceID, span.SpanContext().TraceID().String())
+	assert.Equal(t, parentID, span.Parent().SpanID().String())
+
+	_, err = tracing.Setup(context.Background(), "zipkin")
+	assert.ErrorIs(t, err, tracing.ErrorExporter)
+
+	os.Remove(cfg.StoragePath)
+}
@@ -0,0 +1,295 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/models"
+	"url-shortener/internal/services"
+	"url-shortener/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Import formats accepted by ImportURLs
+const (
+	importCSV    = "csv"
+	importNDJSON = "ndjson"
+)
+
+// maxImportLine bounds the length of a single NDJSON line
+const maxImportLine = 64 * 1024
+
+// errorImportHeader is returned for CSV imports without a url column
+var errorImportHeader = errors.New("CSV header has no url column")
+
+// importLine is a single NDJSON import row with the expiry kept as text
+type importLine struct {
+	URL       string   `json:"url"`
+	Alias     string   `json:"alias"`
+	Tags      []string `json:"tags"`
+	ExpiresAt string   `json:"expires_at"`
+	Domain    string   `json:"domain"`
+	Deleted   bool     `json:"deleted"`
+}
+
+// @Summary Import links
+// @Description Creates links from a CSV file with a header row (url, alias, tags, expires_at, domain, deleted) or from NDJSON objects with the same fields.
+// @Description Rows are validated like batch shortening and reported one by one, so invalid rows don't fail the whole import.
+// @Description Rows of deleted links, as in CSV exports, are skipped.
+// @Description Tags in CSV are separated by ';', expiries are RFC 3339 timestamps or YYYY-MM-DD dates.
+// @Tags urls
+// @Accept text/csv,application/x-ndjson
+// @Produce json
+// @Security Bearer
+// @Param Authorization header string true "Bearer JWT token"
+// @Param format query string false "csv or ndjson, taken from Content-Type by default"
+// @Param request body string true "CSV or NDJSON rows"
+// @Success 200 {object} models.ImportReport "Result of every row"
+// @Failure 400 {object} models.Problem "Error reading body!/CSV header has no url column!"
+// @Failure 413 {object} models.Problem "Request body is too large!"
+// @Failure 415 {object} models.Problem "Unsupported import format!"
+// @Router /api/v1/user/urls/import [post]
+func (t *Handler) ImportURLs(c *gin.Context, cfg config.Config) {
+	format := strings.ToLower(c.Query("format"))
+	if format == "" {
+		format = importFormat(c.GetHeader("Content-Type"))
+	}
+
+	report := models.ImportReport{Results: []models.ImportResult{}}
+	add := func(n int, row models.ImportRow, err error) {
+		res := models.ImportResult{Row: n}
+		switch {
+		case err != nil:
+			res.Status, res.Error = models.ImportFailed, err.Error()
+		case row.Deleted:
+			res.Status = models.ImportSkipped
+		default:
+			res = t.importRow(c, cfg, n, row)
+		}
+
+		switch res.Status {
+		case models.ImportCreated:
+			report.Created++
+		case models.ImportExisting:
+			report.Existing++
+		case models.ImportSkipped:
+			report.Skipped++
+		default:
+			report.Failed++
+		}
+		report.Results = append(report.Results, res)
+	}
+
+	var err error
+	switch format {
+	case importCSV:
+		err = readCSV(c.Request.Body, add)
+	case importNDJSON:
+		err = readNDJSON(c.Request.Body, add)
+	default:
+		Fail(c, http.StatusUnsupportedMediaType, "Unsupported import format!", errorFormat)
+		return
+	}
+
+	if err != nil {
+		if tooLarge(err) {
+			Fail(c, http.StatusRequestEntityTooLarge, "Request body is too large!", nil)
+			return
+		}
+		if errors.Is(err, errorImportHeader) {
+			Fail(c, http.StatusBadRequest, "CSV header has no url column!", err)
+			return
+		}
+		Fail(c, http.StatusBadRequest, "Error reading body!", errorBody)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// importRow validates and saves a single row the same way batch shortening does
+func (t *Handler) importRow(c *gin.Context, cfg config.Config, n int, row models.ImportRow) models.ImportResult {
+	res := models.ImportResult{Row: n, Status: models.ImportFailed}
+
+	domain, errs := t.validateLink(c, cfg, "url", row.URL, "domain", row.Domain)
+	if len(errs) > 0 {
+		res.Error = errs[0].Message
+		return res
+	}
+	row.Domain = domain
+
+	var err error
+	row.URL, err = t.resolveURL(c, cfg, row.URL)
+	if err != nil {
+		res.Error = resolveFailure(err)
+		return res
+	}
+
+	rec, created, err := t.service.ImportURL(c.Request.Context(), c.GetString("user_id"), row)
+	if err != nil {
+		res.Error = importError(err)
+		return res
+	}
+
+	res.Status = models.ImportExisting
+	if created {
+		res.Status = models.ImportCreated
+	}
+	res.ShortURL = cfg.ShortURL(rec.Domain, rec.ShortURL)
+	return res
+}
+
+// importError returns the message reported for a row that couldn't be imported
+func importError(err error) string {
+	for _, known := range []error{
+		services.ErrorInvalidURL, services.ErrorInvalidAlias, services.ErrorAliasTaken,
+		services.ErrorReservedAlias, services.ErrorInvalidTags, services.ErrorExpired, services.ErrorBlocked,
+	} {
+		if errors.Is(err, known) {
+			return known.Error()
+		}
+	}
+	if errors.Is(err, storage.ErrorDuplicate) {
+		return "URL is already shortened"
+	}
+	return "can't save URL"
+}
+
+// Streamed reports whether a request body of the given Content-Type is read as an NDJSON stream
+func Streamed(contentType string) bool {
+	return importFormat(contentType) == importNDJSON
+}
+
+// importFormat picks the import format from a Content-Type header
+func importFormat(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv", "application/csv":
+		return importCSV
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/json-seq":
+		return importNDJSON
+	}
+	return ""
+}
+
+// readCSV streams CSV rows to add, mapping columns by the header row
+func readCSV(r io.Reader, add func(n int, row models.ImportRow, err error)) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return errorImportHeader
+		}
+		return err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return errorImportHeader
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	for n := 1; ; n++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return err
+			}
+			add(n, models.ImportRow{}, errors.New("malformed CSV row"))
+			continue
+		}
+
+		row := models.ImportRow{
+			URL:    field(record, "url"),
+			Alias:  field(record, "alias"),
+			Tags:   strings.Split(field(record, "tags"), ";"),
+			Domain: field(record, "domain"),
+		}
+		row.ExpiresAt, err = parseExpiry(field(record, "expires_at"))
+		if err == nil {
+			row.Deleted, err = parseFlag(field(record, "deleted"))
+		}
+		add(n, row, err)
+	}
+}
+
+// readNDJSON streams one JSON object per line to add, skipping blank lines
+func readNDJSON(r io.Reader, add func(n int, row models.ImportRow, err error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxImportLine)
+
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var line importLine
+		if err := json.Unmarshal([]byte(text), &line); err != nil {
+			add(n, models.ImportRow{}, errors.New("malformed JSON"))
+			continue
+		}
+
+		row := models.ImportRow{
+			URL:     strings.TrimSpace(line.URL),
+			Alias:   line.Alias,
+			Tags:    line.Tags,
+			Domain:  line.Domain,
+			Deleted: line.Deleted,
+		}
+		expiresAt, err := parseExpiry(line.ExpiresAt)
+		row.ExpiresAt = expiresAt
+		add(n, row, err)
+	}
+	return scanner.Err()
+}
+
+// parseFlag reads a true/false CSV column, empty meaning false
+func parseFlag(s string) (bool, error) {
+	if s == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, errors.New("malformed deleted flag")
+	}
+	return b, nil
+}
+
+// parseExpiry reads an RFC 3339 timestamp or a date, which expires at its start in UTC
+func parseExpiry(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, errors.New("malformed expiry")
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// previewData holds the link details shown on the preview page
+type previewData struct {
+	URL         string
+	Title       string
+	Description string
+	CreatedAt   time.Time
+}
+
+// previewPage renders the interstitial shown instead of redirecting when a link preview is requested
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex, nofollow">
+<title>{{if .Title}}{{.Title}}{{else}}Link preview{{end}}</title>
+</head>
+<body>
+<h1>{{if .Title}}{{.Title}}{{else}}Link preview{{end}}</h1>
+<p>This short link leads to:</p>
+<p><a href="{{.URL}}" rel="noopener noreferrer nofollow">{{.URL}}</a></p>
+{{- if .Description}}
+<p>{{.Description}}</p>
+{{- end}}
+{{- if not .CreatedAt.IsZero}}
+<p>Created on {{.CreatedAt.Format "2 January 2006"}}</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// disabledPage warns visitors of a link disabled because its destination is on the blocklist
+var disabledPage = template.Must(template.New("disabled").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex, nofollow">
+<title>Link disabled</title>
+</head>
+<body>
+<h1>Link disabled</h1>
+<p>This short link has been disabled because its destination was reported as harmful, for example phishing or malware.</p>
+<p>The link led to: <code>{{.URL}}</code></p>
+</body>
+</html>
+`))
+
+// threatData holds the details shown on the threat warning page
+type threatData struct {
+	URL    string
+	Threat string
+}
+
+// threatPage warns visitors of a destination found on a threat list, letting them continue at their own risk
+var threatPage = template.Must(template.New("threat").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex, nofollow">
+<title>Warning: unsafe link</title>
+</head>
+<body>
+<h1>Warning: unsafe link</h1>
+<p>The destination of this short link is listed as a potential threat ({{.Threat}}).
+It may try to steal your personal information or install harmful software.</p>
+<p>The link leads to: <code>{{.URL}}</code></p>
+<p><a href="{{.URL}}" rel="noopener noreferrer nofollow">Continue anyway</a></p>
+</body>
+</html>
+`))
+
+// cardData holds the social card shown to link unfurling bots
+type cardData struct {
+	URL         string
+	Title       string
+	Description string
+	Image       string
+}
+
+// cardPage carries the Open Graph and Twitter Card tags read by link unfurling bots,
+// redirecting anything that renders it to the destination
+var cardPage = template.Must(template.New("card").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<meta property="og:type" content="website">
+<meta property="og:url" content="{{.URL}}">
+<meta property="og:title" content="{{.Title}}">
+{{- if .Description}}
+<meta property="og:description" content="{{.Description}}">
+<meta name="description" content="{{.Description}}">
+{{- end}}
+{{- if .Image}}
+<meta property="og:image" content="{{.Image}}">
+<meta name="twitter:card" content="summary_large_image">
+<meta name="twitter:image" content="{{.Image}}">
+{{- else}}
+<meta name="twitter:card" content="summary">
+{{- end}}
+<meta name="twitter:title" content="{{.Title}}">
+{{- if .Description}}
+<meta name="twitter:description" content="{{.Description}}">
+{{- end}}
+<meta http-equiv="refresh" content="0; url={{.URL}}">
+</head>
+<body>
+<p><a href="{{.URL}}">{{.Title}}</a></p>
+</body>
+</html>
+`))
+
+// renderPage executes an HTML template and writes it with the given status code
+func (t *Handler) renderPage(c *gin.Context, status int, page *template.Template, data any) {
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, data); err != nil {
+		t.log.Error("failed to render page", "error", err, "page", page.Name())
+		Fail(c, http.StatusInternalServerError, "Can't render page!", nil)
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"net/http"
+	"url-shortener/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -21,5 +22,5 @@ func (t *Handler) PingDB(c *gin.Context) {
 		return
 	}
 
-	c.String(http.StatusInternalServerError, "Can't connect to the Database!")
+	Fail(c, http.StatusInternalServerError, "Can't connect to the Database!", services.ErrorNoDB)
 }
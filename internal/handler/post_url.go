@@ -2,11 +2,9 @@ package handler
 
 import (
 	"errors"
-	"fmt"
-	"io"
 	"net/http"
-	"net/url"
 	"url-shortener/internal/config"
+	"url-shortener/internal/services"
 	"url-shortener/internal/storage"
 
 	"github.com/gin-gonic/gin"
@@ -14,45 +12,54 @@ import (
 
 // @Summary Create shortened URL
 // @Description Creates a shortened version of a provided URL
+// @Description Links to this service and to known external shorteners are resolved to their final destination
 // @Tags urls
 // @Accept plain
 // @Produce plain
 // @Security Bearer
 // @Param Authorization header string true "Bearer JWT token"
 // @Param url body string true "Original URL to shorten"
+// @Param domain query string false "Branded domain of the short URL"
 // @Success 201 {string} string "Shortened URL"
-// @Failure 400 {string} string "Can't read body!/Empty body!/Malformed URI!/Couldn't encode URL!"
+// @Failure 400 {object} models.Problem "Request has invalid fields!"
+// @Failure 400 {string} string "Can't read body!/URL points to this service!/Redirect chain is too long!/Couldn't encode URL!"
+// @Failure 403 {string} string "URL is blocked!"
 // @Failure 409 {string} string "URL already exists"
-// @Router /api/url [post]
+// @Failure 413 {string} string "Request body is too large!"
+// @Router / [post]
 func (t *Handler) PostURL(c *gin.Context, cfg config.Config) {
-	body, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.String(http.StatusBadRequest, "Cant read body!")
+	body, ok := ReadBody(c, "Cant read body!")
+	if !ok {
 		return
 	}
 
-	if len(body) == 0 {
-		c.String(http.StatusBadRequest, "Empty body!")
+	urlStr := string(body)
+	domain, errs := t.validateLink(c, cfg, "url", urlStr, "domain", c.Query("domain"))
+	if len(errs) > 0 {
+		invalid(c, errs)
 		return
 	}
 
-	urlStr := string(body)
-	parsedURL, err := url.Parse(urlStr)
-	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
-		c.String(http.StatusBadRequest, "Malformed URI!")
+	urlStr, err := t.resolveURL(c, cfg, urlStr)
+	if err != nil {
+		resolveError(c, err)
 		return
 	}
 
 	userID := c.GetString("user_id")
 
-	shortURL, err := t.service.SaveURL(c.Request.Context(), urlStr, string(userID))
-	shortURL = fmt.Sprintf("%s/%s", cfg.BaseURL, shortURL)
+	shortURL, err := t.service.SaveURL(c.Request.Context(), urlStr, string(userID), domain)
+	shortURL = cfg.ShortURL(domain, shortURL)
 	if err != nil {
 		if errors.Is(err, storage.ErrorDuplicate) {
 			c.String(http.StatusConflict, shortURL)
 			return
 		}
-		c.String(http.StatusBadRequest, "Couldn't encode URL!")
+		if errors.Is(err, services.ErrorBlocked) {
+			Fail(c, http.StatusForbidden, "URL is blocked!", services.ErrorBlocked)
+			return
+		}
+		Fail(c, http.StatusBadRequest, "Couldn't encode URL!", nil)
 		return
 	}
 	c.String(http.StatusCreated, shortURL)
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"url-shortener/internal/blocklist"
+	"url-shortener/internal/idempotency"
+	"url-shortener/internal/models"
+	"url-shortener/internal/services"
+	"url-shortener/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType is the media type of RFC 7807 error responses
+const ProblemContentType = "application/problem+json"
+
+// Errors of requests rejected by the handlers themselves, used to pick problem codes
+var (
+	errorBody          = errors.New("malformed request body")
+	errorUnknownDomain = errors.New("unknown domain")
+	errorURLExpired    = errors.New("URL has expired")
+	errorTooManyItems  = errors.New("too many items")
+	errorFormat        = errors.New("unsupported format")
+	errorUntrusted     = errors.New("IP address is not trusted")
+	errorQROptions     = errors.New("invalid QR code options")
+	errorValidation    = errors.New("request has invalid fields")
+)
+
+// problemCodes maps known errors to the codes of problem responses, checked in order
+var problemCodes = []struct {
+	err  error
+	code string
+}{
+	{errorBody, "malformed_body"},
+	{errorUnknownDomain, "unknown_domain"},
+	{errorURLExpired, "url_expired"},
+	{errorTooManyItems, "too_many_items"},
+	{errorFormat, "unsupported_format"},
+	{errorUntrusted, "untrusted_ip"},
+	{errorImportHeader, "missing_url_column"},
+	{storage.ErrorURLDeleted, "url_deleted"},
+	{storage.ErrorDuplicate, "duplicate_url"},
+	{storage.ErrorNotFound, "url_not_found"},
+	{services.ErrorNotFound, "url_not_found"},
+	{services.ErrorNoDB, "database_unavailable"},
+	{services.ErrorForbidden, "not_owner"},
+	{services.ErrorInvalidSettings, "invalid_settings"},
+	{services.ErrorInvalidURL, "invalid_url"},
+	{services.ErrorBlocked, "url_blocked"},
+	{services.ErrorNoBlocklist, "no_blocklist"},
+	{services.ErrorSelfReference, "self_reference"},
+	{services.ErrorRedirectChain, "redirect_chain"},
+	{services.ErrorInvalidAlias, "invalid_alias"},
+	{services.ErrorAliasTaken, "alias_taken"},
+	{services.ErrorReservedAlias, "reserved_alias"},
+	{services.ErrorInvalidTags, "invalid_tags"},
+	{services.ErrorExpired, "expiry_in_past"},
+	{blocklist.ErrorInvalidEntry, "invalid_blocklist_entry"},
+	{errorQROptions, "invalid_qr_options"},
+	{errorValidation, "validation_failed"},
+	{idempotency.ErrorMismatch, "idempotency_key_reused"},
+	{idempotency.ErrorInProgress, "idempotency_key_in_progress"},
+	{idempotency.ErrorFull, "idempotency_keys_exhausted"},
+	{idempotency.ErrorUnsupported, "idempotency_key_unsupported"},
+}
+
+// Fail writes an error response. Routes of the versioned API, marked by the "problem" context key,
+// get an RFC 7807 problem with a code mapped from err, legacy routes get the message as plain text.
+func Fail(c *gin.Context, status int, message string, err error) {
+	if !c.GetBool("problem") {
+		c.String(status, message)
+		return
+	}
+	writeProblem(c, newProblem(c, status, message, err))
+}
+
+// newProblem builds the problem response of an error
+func newProblem(c *gin.Context, status int, message string, err error) models.Problem {
+	return models.Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   message,
+		Instance: c.Request.URL.Path,
+		Code:     problemCode(status, err),
+	}
+}
+
+// writeProblem writes p as application/problem+json
+func writeProblem(c *gin.Context, p models.Problem) {
+	c.Header("Content-Type", ProblemContentType)
+	c.JSON(p.Status, p)
+}
+
+// problemCode returns the code of a known error or, for others, a generic code of the status
+func problemCode(status int, err error) string {
+	for _, known := range problemCodes {
+		if errors.Is(err, known.err) {
+			return known.code
+		}
+	}
+
+	switch status {
+	case http.StatusBadRequest:
+		return "bad_request"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusConflict:
+		return "conflict"
+	case http.StatusGone:
+		return "gone"
+	case http.StatusRequestEntityTooLarge:
+		return "body_too_large"
+	case http.StatusUnsupportedMediaType:
+		return "unsupported_media_type"
+	case http.StatusUnprocessableEntity:
+		return "unprocessable"
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	}
+	return "internal_error"
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"url-shortener/internal/config"
+	"url-shortener/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resolveURL replaces links to our own short domains and to known external shorteners with the URL
+// they finally lead to, so that new links never point to another short link
+func (t *Handler) resolveURL(c *gin.Context, cfg config.Config, url string) (string, error) {
+	depth := cfg.MaxRedirectDepth
+	if depth <= 0 {
+		depth = config.DefaultRedirectDepth
+	}
+
+	for range depth + 1 {
+		domain, id, own := cfg.ShortCode(url)
+		if !own {
+			next, err := t.service.ExpandURL(c.Request.Context(), url)
+			if err != nil {
+				return "", err
+			}
+			if next == url {
+				return url, nil
+			}
+			url = next
+			continue
+		}
+
+		if id == "" {
+			return "", services.ErrorSelfReference
+		}
+
+		rec, err := t.service.GetURL(c.Request.Context(), domain, id)
+		if err != nil {
+			return "", services.ErrorSelfReference
+		}
+		url = rec.URL
+	}
+	return "", services.ErrorRedirectChain
+}
+
+// resolveError writes the response of a destination that couldn't be resolved
+func resolveError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrorSelfReference):
+		Fail(c, http.StatusBadRequest, "URL points to this service!", err)
+	case errors.Is(err, services.ErrorRedirectChain):
+		Fail(c, http.StatusBadRequest, "Redirect chain is too long!", err)
+	default:
+		Fail(c, http.StatusBadRequest, "Can't resolve redirect chain!", err)
+	}
+}
+
+// resolveFailure returns the message reported for a batch or import item whose destination couldn't be resolved
+func resolveFailure(err error) string {
+	if errors.Is(err, services.ErrorSelfReference) || errors.Is(err, services.ErrorRedirectChain) {
+		return err.Error()
+	}
+	return "can't resolve redirect chain"
+}
@@ -2,57 +2,173 @@ package handler
 
 import (
 	"encoding/json"
-	"io"
+	"errors"
 	"net/http"
+	"strconv"
 	"url-shortener/internal/config"
 	"url-shortener/internal/models"
+	"url-shortener/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 // @Summary Shorten multiple URLs in batch
 // @Description Creates shortened versions for multiple URLs in a single request
+// @Description Links to this service and to known external shorteners are resolved to their final destination
+// @Description Items are shortened one by one, each reported as created, existing, invalid, blocked or error.
+// @Description atomic=true saves all items in one transaction and fails the whole batch on the first error.
+// @Description With Content-Type application/x-ndjson items are read one per line and their results streamed back as NDJSON.
 // @Tags urls
-// @Accept json
-// @Produce json
+// @Accept json,application/x-ndjson
+// @Produce json,application/x-ndjson
 // @Security Bearer
 // @Param Authorization header string true "Bearer JWT token"
 // @Param request body []models.BatchUnitURLRequest true "Array of URLs to shorten"
+// @Param atomic query bool false "Save all items or none"
 // @Success 201 {array} models.BatchUnitURLResponse "Array of shortened URLs"
-// @Failure 400 {string} string "Error reading body!/Error unmarshalling body!/Empty or malformed body sent!/Error saving URLs!"
-// @Router /api/shorten/batch [post]
+// @Success 207 {array} models.BatchUnitURLResponse "Result of every item when some failed"
+// @Failure 400 {object} models.Problem "Error reading body!/Error unmarshalling body!/Empty or malformed body sent!/Request has invalid fields!/URL points to this service!/Redirect chain is too long!/Error saving URLs!"
+// @Failure 400 {object} models.Problem "Atomic batches can't be streamed!"
+// @Failure 403 {object} models.Problem "URL is blocked!"
+// @Failure 413 {object} models.Problem "Too many items!/Request body is too large!"
+// @Router /api/v1/shorten/batch [post]
 func (t *Handler) ShortenBatch(c *gin.Context, cfg config.Config) {
 	var req []models.BatchUnitURLRequest
 	var res []models.BatchUnitURLResponse
 
-	body, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.String(http.StatusBadRequest, "Error reading body!")
+	atomic, _ := strconv.ParseBool(c.Query("atomic"))
+
+	if Streamed(c.GetHeader("Content-Type")) {
+		if atomic {
+			Fail(c, http.StatusBadRequest, "Atomic batches can't be streamed!", nil)
+			return
+		}
+		t.streamBatch(c, cfg)
+		return
+	}
+
+	body, ok := ReadBody(c, "Error reading body!")
+	if !ok {
 		return
 	}
 
-	err = json.Unmarshal(body, &req)
+	err := json.Unmarshal(body, &req)
 	if err != nil {
-		c.String(http.StatusBadRequest, "Error unmarshalling body!")
+		Fail(c, http.StatusBadRequest, "Error unmarshalling body!", errorBody)
 		return
 	}
 
 	if len(req) == 0 {
-		c.String(http.StatusBadRequest, "Empty or malformed body sent!")
+		Fail(c, http.StatusBadRequest, "Empty or malformed body sent!", errorBody)
+		return
+	}
+
+	if len(req) > batchLimit(cfg) {
+		Fail(c, http.StatusRequestEntityTooLarge, "Too many items!", errorTooManyItems)
 		return
 	}
 
 	userID := c.GetString("user_id")
 
+	if !atomic {
+		t.shortenEach(c, cfg, userID, req)
+		return
+	}
+
+	var errs []models.FieldError
+	for i := range req {
+		field := "[" + strconv.Itoa(i) + "]."
+		domain, fieldErrs := t.validateLink(c, cfg, field+"original_url", req[i].URL, field+"domain", req[i].Domain)
+		req[i].Domain = domain
+		errs = append(errs, fieldErrs...)
+	}
+	if len(errs) > 0 {
+		invalid(c, errs)
+		return
+	}
+
+	for i := range req {
+		req[i].URL, err = t.resolveURL(c, cfg, req[i].URL)
+		if err != nil {
+			resolveError(c, err)
+			return
+		}
+	}
+
 	err = t.service.ShortenBatch(c.Request.Context(), userID, req, &res)
 	if err != nil {
-		c.String(http.StatusBadRequest, "Error saving URLs!")
+		if errors.Is(err, services.ErrorBlocked) {
+			Fail(c, http.StatusForbidden, "URL is blocked!", services.ErrorBlocked)
+			return
+		}
+		Fail(c, http.StatusBadRequest, "Error saving URLs!", nil)
 		return
 	}
 
 	for i := range res {
-		res[i].Short = cfg.BaseURL + "/" + res[i].Short
+		res[i].Short = cfg.ShortURL(res[i].Domain, res[i].Short)
 	}
 
 	c.JSON(http.StatusCreated, res)
 }
+
+// shortenEach shortens batch items independently, answering 207 when some of them failed
+func (t *Handler) shortenEach(c *gin.Context, cfg config.Config, userID string, req []models.BatchUnitURLRequest) {
+	res := t.processItems(c, cfg, userID, req, make([]models.BatchUnitURLResponse, len(req)))
+
+	status := http.StatusCreated
+	for i := range res {
+		if !res[i].Succeeded() {
+			status = http.StatusMultiStatus
+		}
+	}
+	c.JSON(status, res)
+}
+
+// processItems resolves and shortens the batch items whose result isn't set yet, filling in res with full short URLs
+func (t *Handler) processItems(c *gin.Context, cfg config.Config, userID string, req []models.BatchUnitURLRequest, res []models.BatchUnitURLResponse) []models.BatchUnitURLResponse {
+	var valid []models.BatchUnitURLRequest
+	var index []int
+
+	for i, x := range req {
+		if res[i].Status != "" {
+			continue
+		}
+		res[i] = models.BatchUnitURLResponse{ID: x.ID, Status: models.BatchInvalid}
+
+		domain, errs := t.validateLink(c, cfg, "original_url", x.URL, "domain", x.Domain)
+		if len(errs) > 0 {
+			res[i].Error = errs[0].Message
+			continue
+		}
+		x.Domain = domain
+
+		url, err := t.resolveURL(c, cfg, x.URL)
+		if err != nil {
+			res[i].Error = resolveFailure(err)
+			continue
+		}
+		x.URL = url
+
+		valid = append(valid, x)
+		index = append(index, i)
+	}
+
+	if len(valid) > 0 {
+		for i, x := range t.service.ShortenEach(c.Request.Context(), userID, valid) {
+			if x.Short != "" {
+				x.Short = cfg.ShortURL(x.Domain, x.Short)
+			}
+			res[index[i]] = x
+		}
+	}
+	return res
+}
+
+// batchLimit returns the maximum number of items of a batch request
+func batchLimit(cfg config.Config) int {
+	if cfg.BatchMaxItems <= 0 {
+		return config.DefaultBatchMaxItems
+	}
+	return cfg.BatchMaxItems
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"url-shortener/internal/config"
+	"url-shortener/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamChunk bounds the number of streamed batch items shortened together
+const streamChunk = 100
+
+// streamBatch reads batch items one per NDJSON line and writes the result of each as an NDJSON line in the same order.
+// Items are shortened as soon as no more input is buffered or streamChunk items are pending, so fast clients get
+// bulk inserts while slow ones see every result right away. The body is never read ahead of the results written,
+// which keeps a client that doesn't read its results from filling the server's memory.
+func (t *Handler) streamBatch(c *gin.Context, cfg config.Config) {
+	// HTTP/1 servers stop reading the request body once the response starts unless full duplex is enabled
+	_ = http.NewResponseController(c.Writer).EnableFullDuplex()
+
+	userID := c.GetString("user_id")
+	limit := batchLimit(cfg)
+	enc := json.NewEncoder(c.Writer)
+	r := bufio.NewReaderSize(c.Request.Body, maxImportLine)
+
+	var req []models.BatchUnitURLRequest
+	var res []models.BatchUnitURLResponse
+	flush := func() error {
+		if len(req) == 0 {
+			return nil
+		}
+		if !c.Writer.Written() {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Status(http.StatusOK)
+		}
+
+		res = t.processItems(c, cfg, userID, req, res)
+		for _, x := range res {
+			if err := enc.Encode(x); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		req, res = req[:0], res[:0]
+		return nil
+	}
+
+	n := 0
+	for {
+		if len(req) >= streamChunk || (len(req) > 0 && r.Buffered() == 0) {
+			if err := flush(); err != nil {
+				t.log.Error("failed to write batch results", "error", err)
+				return
+			}
+		}
+
+		line, err := r.ReadSlice('\n')
+		tooLong := errors.Is(err, bufio.ErrBufferFull)
+		for errors.Is(err, bufio.ErrBufferFull) {
+			line = nil
+			_, err = r.ReadSlice('\n')
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 || tooLong {
+			if n++; n > limit {
+				req = append(req, models.BatchUnitURLRequest{})
+				res = append(res, models.BatchUnitURLResponse{
+					Status: models.BatchInvalid,
+					Error:  fmt.Sprintf("batch is limited to %d items", limit),
+				})
+				break
+			}
+
+			var x models.BatchUnitURLRequest
+			var item models.BatchUnitURLResponse
+			if tooLong {
+				item = models.BatchUnitURLResponse{Status: models.BatchInvalid, Error: "item is too long"}
+			} else if err := json.Unmarshal(line, &x); err != nil {
+				item = models.BatchUnitURLResponse{Status: models.BatchInvalid, Error: "malformed JSON"}
+			}
+			req = append(req, x)
+			res = append(res, item)
+		}
+
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.log.Error("failed to read batch stream", "error", err, "items", n)
+			}
+			break
+		}
+	}
+
+	if n == 0 {
+		Fail(c, http.StatusBadRequest, "Empty or malformed body sent!", errorBody)
+		return
+	}
+	if err := flush(); err != nil {
+		t.log.Error("failed to write batch results", "error", err)
+	}
+}
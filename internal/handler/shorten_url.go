@@ -3,10 +3,10 @@ package handler
 import (
 	"encoding/json"
 	"errors"
-	"io"
 	"net/http"
 	"url-shortener/internal/config"
 	"url-shortener/internal/models"
+	"url-shortener/internal/services"
 	"url-shortener/internal/storage"
 
 	"github.com/gin-gonic/gin"
@@ -14,6 +14,7 @@ import (
 
 // @Summary Shorten URL via JSON
 // @Description Creates a shortened version of a URL provided in JSON format
+// @Description Links to this service and to known external shorteners are resolved to their final destination
 // @Tags urls
 // @Accept json
 // @Produce json
@@ -21,39 +22,58 @@ import (
 // @Param Authorization header string true "Bearer JWT token"
 // @Param request body models.ShortenURLRequest true "URL to shorten"
 // @Success 201 {object} models.ShortenURLResponse "Shortened URL"
-// @Success 409 {object} models.ShortenURLResponse "URL already exists"
-// @Router /api/shorten [post]
+// @Failure 409 {object} models.Problem "URL is already shortened, short_url holds the existing link"
+// @Failure 400 {object} models.Problem "Request has invalid fields!/URL points to this service!/Redirect chain is too long!"
+// @Failure 403 {object} models.Problem "URL is blocked!"
+// @Failure 413 {object} models.Problem "Request body is too large!"
+// @Router /api/v1/shorten [post]
 func (t *Handler) ShortenURL(c *gin.Context, cfg config.Config) {
 	var req models.ShortenURLRequest
 	var res models.ShortenURLResponse
 
-	body, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.String(http.StatusBadRequest, "Cant read body!")
+	body, ok := ReadBody(c, "Cant read body!")
+	if !ok {
 		return
 	}
 
-	err = json.Unmarshal(body, &req)
+	err := json.Unmarshal(body, &req)
 	if err != nil {
-		c.String(http.StatusBadRequest, "Couldn't unmarshal!")
+		Fail(c, http.StatusBadRequest, "Couldn't unmarshal!", errorBody)
 		return
 	}
 
-	if req.URL == "" {
-		c.String(http.StatusBadRequest, "Empty body!")
+	domain, errs := t.validateLink(c, cfg, "url", req.URL, "domain", req.Domain)
+	if len(errs) > 0 {
+		invalid(c, errs)
+		return
+	}
+
+	req.URL, err = t.resolveURL(c, cfg, req.URL)
+	if err != nil {
+		resolveError(c, err)
 		return
 	}
 
 	userID := c.GetString("user_id")
 
-	shortURL, err := t.service.SaveURL(c.Request.Context(), req.URL, userID)
-	res.Result = cfg.BaseURL + "/" + string(shortURL)
+	shortURL, err := t.service.SaveURL(c.Request.Context(), req.URL, userID, domain)
+	res.Result = cfg.ShortURL(domain, shortURL)
 	if err != nil {
 		if errors.Is(err, storage.ErrorDuplicate) {
+			if c.GetBool("problem") {
+				p := newProblem(c, http.StatusConflict, "URL is already shortened!", err)
+				p.ShortURL = res.Result
+				writeProblem(c, p)
+				return
+			}
 			c.JSON(http.StatusConflict, res)
 			return
 		}
-		c.String(http.StatusBadRequest, "Couldn't encode URL!")
+		if errors.Is(err, services.ErrorBlocked) {
+			Fail(c, http.StatusForbidden, "URL is blocked!", services.ErrorBlocked)
+			return
+		}
+		Fail(c, http.StatusBadRequest, "Couldn't encode URL!", nil)
 		return
 	}
 
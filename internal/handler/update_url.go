@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"url-shortener/internal/config"
+	"url-shortener/internal/models"
+	"url-shortener/internal/services"
+	"url-shortener/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Update link settings
+// @Description Partially updates the settings of a link owned by the user, including its social card
+// @Tags urls
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer JWT token"
+// @Param id path string true "Shortened URL ID"
+// @Param domain query string false "Branded domain of the link"
+// @Param request body models.UpdateURLRequest true "Link settings to change"
+// @Success 200 {object} models.UserURLResponse "Updated link"
+// @Failure 400 {object} models.Problem "Error reading body!/Error unmarshalling body!/Invalid link settings!"
+// @Failure 403 {object} models.Problem "URL belongs to another user!/URL is blocked!"
+// @Failure 404 {object} models.Problem "URL not found!"
+// @Failure 410 {object} models.Problem "URL was deleted!"
+// @Router /api/v1/user/urls/{id} [patch]
+func (t *Handler) UpdateURL(c *gin.Context, cfg config.Config) {
+	var req models.UpdateURLRequest
+
+	body, ok := ReadBody(c, "Error reading body!")
+	if !ok {
+		return
+	}
+
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		Fail(c, http.StatusBadRequest, "Error unmarshalling body!", errorBody)
+		return
+	}
+
+	userID := c.GetString("user_id")
+
+	rec, err := t.service.UpdateURL(c.Request.Context(), userID, linkDomain(c), c.Param("id"), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrorInvalidSettings):
+			Fail(c, http.StatusBadRequest, "Invalid link settings!", err)
+		case errors.Is(err, services.ErrorBlocked):
+			Fail(c, http.StatusForbidden, "URL is blocked!", services.ErrorBlocked)
+		case errors.Is(err, services.ErrorForbidden):
+			Fail(c, http.StatusForbidden, "URL belongs to another user!", services.ErrorForbidden)
+		case errors.Is(err, storage.ErrorURLDeleted):
+			Fail(c, http.StatusGone, "URL was deleted!", storage.ErrorURLDeleted)
+		case errors.Is(err, services.ErrorNotFound), errors.Is(err, storage.ErrorNotFound):
+			Fail(c, http.StatusNotFound, "URL not found!", services.ErrorNotFound)
+		default:
+			Fail(c, http.StatusInternalServerError, "Error updating URL!", nil)
+		}
+		return
+	}
+
+	res := rec.UserURL()
+	res.ShortURL = cfg.ShortURL(rec.Domain, res.ShortURL)
+
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"url-shortener/internal/config"
+	"url-shortener/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Codes of field validation errors
+const (
+	fieldRequired      = "required"
+	fieldTooLong       = "too_long"
+	fieldMalformed     = "malformed"
+	fieldScheme        = "scheme_not_allowed"
+	fieldUnknownDomain = "unknown_domain"
+)
+
+// ReadBody reads the whole request body. Bodies over the configured size limit are answered with 413,
+// other read errors with 400 and message.
+func ReadBody(c *gin.Context, message string) ([]byte, bool) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		if tooLarge(err) {
+			Fail(c, http.StatusRequestEntityTooLarge, "Request body is too large!", nil)
+			return nil, false
+		}
+		Fail(c, http.StatusBadRequest, message, errorBody)
+		return nil, false
+	}
+	return body, true
+}
+
+// tooLarge reports whether err was caused by a request body over its size limit
+func tooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+// validateURL checks a URL to shorten against the length limit and allowed schemes, returning nil if it's valid
+func validateURL(cfg config.Config, field, raw string) *models.FieldError {
+	limit := cfg.MaxURLLength
+	if limit <= 0 {
+		limit = config.DefaultMaxURLLength
+	}
+
+	switch {
+	case raw == "":
+		return &models.FieldError{Field: field, Code: fieldRequired, Message: "URL is required"}
+	case len(raw) > limit:
+		return &models.FieldError{Field: field, Code: fieldTooLong, Message: fmt.Sprintf("URL is longer than %d characters", limit)}
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || (u.Host == "" && u.Opaque == "") {
+		return &models.FieldError{Field: field, Code: fieldMalformed, Message: "URL must be absolute"}
+	}
+	schemes := cfg.Schemes()
+	if !slices.Contains(schemes, strings.ToLower(u.Scheme)) {
+		return &models.FieldError{Field: field, Code: fieldScheme, Message: "URL scheme must be one of " + strings.Join(schemes, ", ")}
+	}
+	return nil
+}
+
+// invalid answers a create request with invalid fields with a 400 problem listing them.
+// Unlike other errors it is structured on the legacy routes too.
+func invalid(c *gin.Context, errs []models.FieldError) {
+	p := newProblem(c, http.StatusBadRequest, "Request has invalid fields!", errorValidation)
+	p.Errors = errs
+	writeProblem(c, p)
+}
+
+// validateLink checks the URL and requested domain of a link to create, returning the domain it is created on.
+// Field errors are reported under urlField and domainField.
+func (t *Handler) validateLink(c *gin.Context, cfg config.Config, urlField, rawURL, domainField, requested string) (string, []models.FieldError) {
+	var errs []models.FieldError
+	if fe := validateURL(cfg, urlField, rawURL); fe != nil {
+		errs = append(errs, *fe)
+	}
+
+	domain, ok := t.createDomain(c, cfg, requested)
+	if !ok {
+		errs = append(errs, models.FieldError{Field: domainField, Code: fieldUnknownDomain, Message: "unknown domain"})
+	}
+	return domain, errs
+}
@@ -0,0 +1,167 @@
+// Package health checks whether link destinations still respond.
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/netguard"
+)
+
+// Checker issues HEAD requests, falling back to GET, with a limit on concurrent requests
+// and a minimum delay between requests to the same host
+type Checker struct {
+	client      *http.Client
+	concurrency int
+	hostDelay   time.Duration
+
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+// New creates a Checker. A client with a 10 second timeout that only connects to public
+// addresses is used if client is nil.
+func New(client *http.Client, concurrency int, hostDelay time.Duration) *Checker {
+	if client == nil {
+		client = netguard.Client(10 * time.Second)
+	}
+	return &Checker{
+		client:      client,
+		concurrency: max(concurrency, 1),
+		hostDelay:   hostDelay,
+		next:        make(map[string]time.Time),
+	}
+}
+
+// CheckAll checks every URL and calls report with its index and result.
+// URLs are grouped by host and each host is checked in order by its own goroutine, which
+// waits out the host delay before it takes one of the concurrency slots, so that hosts with
+// many links don't hold slots while sleeping. report is called concurrently from several goroutines.
+func (c *Checker) CheckAll(ctx context.Context, urls []string, report func(i int, h models.Health)) {
+	byHost := make(map[string][]int)
+	for i, u := range urls {
+		host := hostOf(u)
+		byHost[host] = append(byHost[host], i)
+	}
+	c.prune()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, c.concurrency)
+
+	for host, idx := range byHost {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, i := range idx {
+				if err := c.wait(ctx, host); err != nil {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case sem <- struct{}{}:
+				}
+				h := c.Check(ctx, urls[i])
+				c.done(host)
+				<-sem
+
+				report(i, h)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Check requests a single URL and measures the time to its response headers
+func (c *Checker) Check(ctx context.Context, rawURL string) models.Health {
+	start := time.Now()
+	status, err := c.do(ctx, http.MethodHead, rawURL)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = c.do(ctx, http.MethodGet, rawURL)
+	}
+
+	h := models.Health{
+		Status:    status,
+		LatencyMS: time.Since(start).Milliseconds(),
+		CheckedAt: start.UTC(),
+	}
+	if err != nil {
+		h.Error = err.Error()
+	}
+	return h
+}
+
+// do sends a request and returns the status code of the final response
+func (c *Checker) do(ctx context.Context, method, rawURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	return res.StatusCode, nil
+}
+
+// hostOf returns the lowercase host name of a URL, empty if it can't be parsed
+func hostOf(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return strings.ToLower(u.Hostname())
+	}
+	return ""
+}
+
+// wait blocks until the next request to host is allowed
+func (c *Checker) wait(ctx context.Context, host string) error {
+	c.mu.Lock()
+	at := c.next[host]
+	c.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// done delays the next request to host by the host delay from now
+func (c *Checker) done(host string) {
+	if c.hostDelay <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	c.next[host] = time.Now().Add(c.hostDelay)
+	c.mu.Unlock()
+}
+
+// prune forgets hosts whose delay has passed so that the map only holds recently checked hosts
+func (c *Checker) prune() {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for host, at := range c.next {
+		if !at.After(now) {
+			delete(c.next, host)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Package idempotency remembers the responses of requests sent with an Idempotency-Key so that retries can be replayed.
+package idempotency
+
+import (
+	"container/list"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default limits of a Store
+const (
+	DefaultMaxEntries = 100_000  // keys held at once
+	DefaultMaxBytes   = 64 << 20 // stored response bodies in total
+	DefaultMaxBody    = 1 << 20  // largest response body that is stored
+)
+
+// Errors returned when a key can't be used for a request
+var (
+	ErrorMismatch    = errors.New("idempotency key was used for a different request")
+	ErrorInProgress  = errors.New("request with this idempotency key is in progress")
+	ErrorFull        = errors.New("too many idempotency keys are in progress")
+	ErrorUnsupported = errors.New("idempotency keys aren't supported for streamed requests")
+)
+
+// Response is a stored response replayed for retries
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// entry is the state of a single key
+type entry struct {
+	key         string
+	fingerprint [32]byte
+	expires     time.Time
+	done        bool
+	res         Response
+	// elem is the position of a finished entry in the eviction order
+	elem *list.Element
+}
+
+// Store keeps the responses of keyed requests in memory until their TTL passes. It holds at most maxEntries keys
+// and maxBytes of response bodies, dropping the oldest finished responses first when either limit is reached.
+type Store struct {
+	ttl        time.Duration
+	maxEntries int
+	maxBytes   int
+	maxBody    int
+
+	mu       sync.Mutex
+	entries  map[string]*entry
+	finished *list.List
+	size     int
+	purged   time.Time
+}
+
+// New creates a Store keeping responses for ttl within the default limits
+func New(ttl time.Duration) *Store {
+	return NewLimited(ttl, DefaultMaxEntries, DefaultMaxBytes, DefaultMaxBody)
+}
+
+// NewLimited creates a Store keeping responses for ttl that holds at most maxEntries keys and maxBytes of
+// response bodies. Responses with bodies over maxBody aren't stored, so retries of such requests run again.
+func NewLimited(ttl time.Duration, maxEntries, maxBytes, maxBody int) *Store {
+	return &Store{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		maxBody:    min(maxBody, maxBytes),
+		entries:    make(map[string]*entry),
+		finished:   list.New(),
+		purged:     time.Now(),
+	}
+}
+
+// Begin claims key for a request with the given fingerprint. It returns the stored response if the request
+// was already answered, ErrorMismatch if the key was used with another fingerprint and ErrorInProgress
+// while the first request with the key hasn't finished. ErrorFull means every slot is taken by a request in
+// progress. A nil response and error mean the caller owns the key and has to call Finish or Release.
+func (s *Store) Begin(key string, fingerprint [32]byte) (*Response, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge(now, false)
+
+	if e, ok := s.entries[key]; ok {
+		if now.Before(e.expires) {
+			switch {
+			case e.fingerprint != fingerprint:
+				return nil, ErrorMismatch
+			case !e.done:
+				return nil, ErrorInProgress
+			}
+			res := e.res
+			return &res, nil
+		}
+		s.remove(e)
+	}
+
+	if len(s.entries) >= s.maxEntries {
+		s.purge(now, true)
+	}
+	for len(s.entries) >= s.maxEntries {
+		if !s.evict() {
+			return nil, ErrorFull
+		}
+	}
+
+	s.entries[key] = &entry{key: key, fingerprint: fingerprint, expires: now.Add(s.ttl)}
+	return nil, nil
+}
+
+// Finish stores the response of a claimed key for the TTL. A response whose body is over the size limit
+// is not stored and the key is forgotten as with Release.
+func (s *Store) Finish(key string, res Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || e.done {
+		return
+	}
+	if len(res.Body) > s.maxBody {
+		s.remove(e)
+		return
+	}
+
+	for s.size+len(res.Body) > s.maxBytes {
+		if !s.evict() {
+			break
+		}
+	}
+	e.done, e.res, e.expires = true, res, time.Now().Add(s.ttl)
+	e.elem = s.finished.PushBack(e)
+	s.size += len(res.Body)
+}
+
+// Release forgets a claimed key without storing a response so that the request can be retried
+func (s *Store) Release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok && !e.done {
+		s.remove(e)
+	}
+}
+
+// MaxBody returns the size of the largest response body that is stored
+func (s *Store) MaxBody() int {
+	return s.maxBody
+}
+
+// Len returns the number of keys held and the bytes of response bodies stored
+func (s *Store) Len() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.entries), s.size
+}
+
+// purge drops expired entries, unless forced at most once a minute
+func (s *Store) purge(now time.Time, force bool) {
+	if !force && now.Sub(s.purged) < time.Minute {
+		return
+	}
+	s.purged = now
+
+	for _, e := range s.entries {
+		if !now.Before(e.expires) {
+			s.remove(e)
+		}
+	}
+}
+
+// evict drops the oldest finished entry, reporting false if there is none
+func (s *Store) evict() bool {
+	front := s.finished.Front()
+	if front == nil {
+		return false
+	}
+	s.remove(front.Value.(*entry))
+	return true
+}
+
+// remove drops an entry and the size of its stored response
+func (s *Store) remove(e *entry) {
+	delete(s.entries, e.key)
+	if e.elem != nil {
+		s.finished.Remove(e.elem)
+		s.size -= len(e.res.Body)
+		e.elem = nil
+	}
+}
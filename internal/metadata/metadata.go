@@ -0,0 +1,150 @@
+// Package metadata fetches the title and Open Graph tags of link destinations.
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/netguard"
+
+	"golang.org/x/net/html"
+)
+
+// Errors returned for destinations that can't be read
+var (
+	ErrorStatus      = errors.New("unexpected status")
+	ErrorContentType = errors.New("destination is not an HTML page")
+)
+
+// maxFieldLength bounds the length of each extracted value
+const maxFieldLength = 1024
+
+// Fetcher downloads the beginning of HTML pages and extracts their metadata
+type Fetcher struct {
+	client   *http.Client
+	maxBytes int64
+	timeout  time.Duration
+}
+
+// New creates a Fetcher reading at most maxBytes of each page within timeout.
+// A client that only connects to public addresses is used if client is nil.
+func New(client *http.Client, maxBytes int64, timeout time.Duration) *Fetcher {
+	if client == nil {
+		client = netguard.Client(0)
+	}
+	return &Fetcher{client: client, maxBytes: maxBytes, timeout: timeout}
+}
+
+// Fetch downloads rawURL and extracts its <title>, og:title, og:description and og:image
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (models.Metadata, error) {
+	var res models.Metadata
+
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return res, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return res, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return res, fmt.Errorf("%w %s", ErrorStatus, resp.Status)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return res, ErrorContentType
+	}
+
+	res = parse(io.LimitReader(resp.Body, f.maxBytes))
+	if res.OGImage != "" {
+		if img, err := resp.Request.URL.Parse(res.OGImage); err == nil {
+			res.OGImage = img.String()
+		}
+	}
+	res.FetchedAt = time.Now().UTC()
+	return res, nil
+}
+
+// parse reads the page head, stopping at <body> or at the end of the input
+func parse(r io.Reader) models.Metadata {
+	var res models.Metadata
+	z := html.NewTokenizer(r)
+	inTitle := false
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return res
+
+		case html.TextToken:
+			if inTitle && res.Title == "" {
+				res.Title = clean(string(z.Text()))
+			}
+
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "title" {
+				inTitle = false
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "body":
+				return res
+			case "title":
+				inTitle = true
+			case "meta":
+				var property, content string
+				for hasAttr {
+					var key, val []byte
+					key, val, hasAttr = z.TagAttr()
+					switch string(key) {
+					case "property", "name":
+						property = strings.ToLower(string(val))
+					case "content":
+						content = clean(string(val))
+					}
+				}
+
+				switch property {
+				case "og:title":
+					res.OGTitle = content
+				case "og:description":
+					res.OGDescription = content
+				case "og:image":
+					if u, err := url.Parse(content); err == nil && (u.Scheme == "" || u.Scheme == "http" || u.Scheme == "https") {
+						res.OGImage = content
+					}
+				}
+			}
+		}
+	}
+}
+
+// clean collapses whitespace and truncates a value to maxFieldLength bytes on a rune boundary
+func clean(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= maxFieldLength {
+		return s
+	}
+	s = s[:maxFieldLength]
+	return strings.ToValidUTF8(s, "")
+}
@@ -0,0 +1,92 @@
+// Package metrics collects the Prometheus metrics of the service and serves them in the text format.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the names of all metrics
+const namespace = "shortener"
+
+// Registry holds the metrics of the service together with Go runtime and process metrics
+var Registry = prometheus.NewRegistry()
+
+// Metrics updated by the transport, handler and service layers
+var (
+	Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	Redirects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redirects_total",
+		Help:      "Visitors redirected to link destinations.",
+	})
+
+	LinksCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "links_created_total",
+		Help:      "Links created by any endpoint.",
+	})
+
+	DeleteQueue = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "delete_queue_depth",
+		Help:      "Links waiting to be deleted.",
+	})
+
+	DeleteCommitDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "delete_batch_commit_duration_seconds",
+		Help:      "Latency of committing a batch of deleted links.",
+		Buckets:   prometheus.DefBuckets,
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Requests, RequestDuration, Redirects, LinksCreated, DeleteQueue, DeleteCommitDuration,
+	)
+}
+
+// WatchDB exports the connection pool stats of db
+func WatchDB(db *sql.DB) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, "urls"))
+}
+
+// WatchFile exports the size of the file storage at path, read on every scrape
+func WatchFile(path string) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "file_storage_size_bytes",
+		Help:      "Size of the file storage.",
+	}, func() float64 {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0
+		}
+		return float64(info.Size())
+	}))
+}
+
+// Handler serves the registered metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -1,8 +1,11 @@
 package models
 
+import "time"
+
 // ShortenURLRequest represents the request payload for shortening a single URL
 type ShortenURLRequest struct {
-	URL string `json:"url"`
+	URL    string `json:"url"`
+	Domain string `json:"domain,omitempty"`
 }
 
 // ShortenURLResponse represents the response payload containing the shortened URL
@@ -15,31 +18,249 @@ type BatchUnitURLRequest struct {
 	ID     string `json:"correlation_id"`
 	URL    string `json:"original_url"`
 	UserID string `json:"user_id"`
+	Domain string `json:"domain,omitempty"`
 }
 
 // BatchUnitURLResponse represents a single URL shortening response in a batch operation
 type BatchUnitURLResponse struct {
-	ID    string `json:"correlation_id"`
-	Short string `json:"short_url"`
+	ID     string `json:"correlation_id"`
+	Short  string `json:"short_url,omitempty"`
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Domain string `json:"-"`
+}
+
+// Outcomes of a single item of a non-atomic batch
+const (
+	BatchCreated  = "created"
+	BatchExisting = "existing"
+	BatchInvalid  = "invalid"
+	BatchBlocked  = "blocked"
+	BatchFailed   = "error"
+)
+
+// Succeeded reports whether the item was shortened, either now or before
+func (r BatchUnitURLResponse) Succeeded() bool {
+	return r.Status == BatchCreated || r.Status == BatchExisting
 }
 
 // UserURLResponse represents a user's URL mapping containing both short and original URLs
 type UserURLResponse struct {
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	Domain      string     `json:"domain,omitempty"`
+	Title       string     `json:"title,omitempty"`
+	Description string     `json:"description,omitempty"`
+	CreatedAt   time.Time  `json:"created_at,omitzero"`
+	QueryPolicy string     `json:"query_policy,omitempty"`
+	UTM         *UTM       `json:"utm,omitempty"`
+	Rules       []Rule     `json:"rules,omitempty"`
+	Variants    []Variant  `json:"variants,omitempty"`
+	Winner      string     `json:"winner,omitempty"`
+	SocialCard  *bool      `json:"social_card,omitempty"`
+	Card        *Card      `json:"card,omitempty"`
+	Disabled    bool       `json:"disabled,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Health      *Health    `json:"health,omitempty"`
+	Metadata    *Metadata  `json:"metadata,omitempty"`
+}
+
+// Query policies control how incoming query parameters are merged onto the destination URL
+const (
+	QueryIgnore   = "ignore"
+	QueryAppend   = "append"
+	QueryOverride = "override"
+)
+
+// UTM holds default UTM parameters appended to the destination URL at redirect time
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// Rule routes visitors matching all of its conditions to an alternative destination.
+// Rules are evaluated in order and the first match wins.
+type Rule struct {
+	OS       []string `json:"os,omitempty"`       // ios, android, windows, macos, chromeos or linux
+	Device   []string `json:"device,omitempty"`   // mobile, tablet, desktop or bot
+	Language []string `json:"language,omitempty"` // Language tags matched against the preferred Accept-Language
+	Country  []string `json:"country,omitempty"`  // ISO 3166-1 alpha-2 country codes of the client IP
+	From     string   `json:"from,omitempty"`     // Start of the time of day window, HH:MM
+	To       string   `json:"to,omitempty"`       // End of the time of day window, HH:MM, exclusive
+	Timezone string   `json:"timezone,omitempty"` // IANA time zone of the window, UTC by default
+	URL      string   `json:"url"`                // Destination for matching visitors
+}
+
+// Variant is one of several weighted destinations of an A/B split link
+type Variant struct {
+	ID     string `json:"id"`     // Short identifier, also stored in the visitor's cookie
+	URL    string `json:"url"`    // Destination of the variant
+	Weight int    `json:"weight"` // Relative share of traffic, 0 pauses the variant
+}
+
+// Visit describes the incoming request a short link is resolved for
+type Visit struct {
+	RawQuery       string
+	UserAgent      string
+	AcceptLanguage string
+	IP             string
+	Country        string
+	Variant        string
+	Time           time.Time
+}
+
+// Click is a single redirect recorded for click analytics
+type Click struct {
+	Domain   string
+	ShortURL string
+	Time     time.Time
+	Country  string
+	Variant  string
+}
+
+// ClickStats aggregates click analytics of a link
+type ClickStats struct {
+	Clicks    int            `json:"clicks"`
+	Countries map[string]int `json:"countries"`
+	Variants  map[string]int `json:"variants"`
+}
+
+// Card holds the owner's overrides of the social card shown to link unfurling bots
+type Card struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+}
+
+// CardEnabled reports whether link unfurling bots get a social card instead of a redirect, which is the default
+func (r URLRecord) CardEnabled() bool {
+	return r.SocialCard == nil || *r.SocialCard
+}
+
+// Health is the result of the latest check of a link's destination
+type Health struct {
+	Status    int       `json:"status,omitempty"` // HTTP status code of the destination
+	LatencyMS int64     `json:"latency_ms"`       // Time to the response headers in milliseconds
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"` // Network error if the destination didn't respond
+}
+
+// Broken reports whether the destination failed to respond or answered with an error status
+func (h *Health) Broken() bool {
+	return h != nil && (h.Error != "" || h.Status >= 400)
+}
+
+// Metadata holds the title and Open Graph tags fetched from a link's destination page
+type Metadata struct {
+	Title         string    `json:"title,omitempty"`
+	OGTitle       string    `json:"og_title,omitempty"`
+	OGDescription string    `json:"og_description,omitempty"`
+	OGImage       string    `json:"og_image,omitempty"`
+	FetchedAt     time.Time `json:"fetched_at"`
 }
 
 // URLRecord represents a complete URL record stored in the system
 type URLRecord struct {
-	UserID   string `json:"user_id"`
-	ShortURL string `json:"short_url"`
-	URL      string `json:"original_url"`
-	Deleted  bool   `json:"deleted"`
+	UserID      string     `json:"user_id"`
+	ShortURL    string     `json:"short_url"`
+	URL         string     `json:"original_url"`
+	Deleted     bool       `json:"deleted"`
+	Disabled    bool       `json:"disabled,omitempty"`
+	Canonical   string     `json:"canonical,omitempty"`
+	Domain      string     `json:"domain,omitempty"`
+	Title       string     `json:"title,omitempty"`
+	Description string     `json:"description,omitempty"`
+	CreatedAt   time.Time  `json:"created_at,omitzero"`
+	QueryPolicy string     `json:"query_policy,omitempty"`
+	UTM         *UTM       `json:"utm,omitempty"`
+	Rules       []Rule     `json:"rules,omitempty"`
+	Variants    []Variant  `json:"variants,omitempty"`
+	Winner      string     `json:"winner,omitempty"`
+	SocialCard  *bool      `json:"social_card,omitempty"`
+	Card        *Card      `json:"card,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Health      *Health    `json:"health,omitempty"`
+	Metadata    *Metadata  `json:"metadata,omitempty"`
+}
+
+// SettingsRecord is a line of the file storage holding a user's settings instead of a link
+type SettingsRecord struct {
+	Settings *UserSettings `json:"user_settings"`
+}
+
+// UserSettings are the preferences of a user
+type UserSettings struct {
+	UserID        string `json:"user_id"`
+	DefaultDomain string `json:"default_domain"`
+}
+
+// UserURL converts the record into its user-facing representation with a bare short code
+func (r URLRecord) UserURL() UserURLResponse {
+	return UserURLResponse{
+		ShortURL:    r.ShortURL,
+		OriginalURL: r.URL,
+		Domain:      r.Domain,
+		Title:       r.Title,
+		Description: r.Description,
+		CreatedAt:   r.CreatedAt,
+		QueryPolicy: r.QueryPolicy,
+		UTM:         r.UTM,
+		Rules:       r.Rules,
+		Variants:    r.Variants,
+		Winner:      r.Winner,
+		SocialCard:  r.SocialCard,
+		Card:        r.Card,
+		Disabled:    r.Disabled,
+		Tags:        r.Tags,
+		ExpiresAt:   r.ExpiresAt,
+		Health:      r.Health,
+		Metadata:    r.Metadata,
+	}
+}
+
+// Expired reports whether the link has an expiry at or before now
+func (r URLRecord) Expired(now time.Time) bool {
+	return r.ExpiresAt != nil && !r.ExpiresAt.After(now)
+}
+
+// UpdateURLRequest represents a partial update of a user's link settings
+type UpdateURLRequest struct {
+	Title       *string    `json:"title,omitempty"`
+	Description *string    `json:"description,omitempty"`
+	QueryPolicy *string    `json:"query_policy,omitempty"`
+	UTM         *UTM       `json:"utm,omitempty"`
+	Rules       *[]Rule    `json:"rules,omitempty"`
+	Variants    *[]Variant `json:"variants,omitempty"`
+	Winner      *string    `json:"winner,omitempty"`
+	SocialCard  *bool      `json:"social_card,omitempty"`
+	Card        *Card      `json:"card,omitempty"`
+}
+
+// DomainRequest represents the payload selecting a user's default short domain
+type DomainRequest struct {
+	Domain string `json:"domain"`
+}
+
+// BlockRequest represents the payload adding a domain, wildcard or regular expression entry to the blocklist
+type BlockRequest struct {
+	Entry string `json:"entry"`
+}
+
+// BlockResponse reports how many existing links were disabled by a new blocklist entry
+type BlockResponse struct {
+	Entry    string `json:"entry"`
+	Disabled int    `json:"disabled"`
 }
 
 // DeleteRecord represents a record for URL deletion
 type DeleteRecord struct {
 	UserID   string `json:"user_id"`
+	Domain   string `json:"domain"`
 	ShortURL string `json:"short_url"`
 }
 
@@ -48,3 +269,64 @@ type Stats struct {
 	Urls  int `json:"urls"`
 	Users int `json:"users"`
 }
+
+// ExportURL represents a link in an export, deleted links included, with its total clicks
+type ExportURL struct {
+	UserURLResponse
+	Deleted bool `json:"deleted"`
+	Clicks  int  `json:"clicks"`
+}
+
+// Outcomes of a single bulk import row
+const (
+	ImportCreated  = "created"
+	ImportExisting = "existing"
+	ImportFailed   = "error"
+	ImportSkipped  = "skipped"
+)
+
+// ImportRow represents a single link of a bulk CSV or NDJSON import
+type ImportRow struct {
+	URL       string     `json:"url"`
+	Alias     string     `json:"alias,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Domain    string     `json:"domain,omitempty"`
+	Deleted   bool       `json:"deleted,omitempty"` // Rows of deleted links, as exported, are skipped
+}
+
+// ImportResult reports the outcome of a single import row, numbered from 1 without the CSV header
+type ImportResult struct {
+	Row      int    `json:"row"`
+	Status   string `json:"status"`
+	ShortURL string `json:"short_url,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ImportReport summarizes a bulk import with the result of every row
+type ImportReport struct {
+	Created  int            `json:"created"`
+	Existing int            `json:"existing"`
+	Failed   int            `json:"failed"`
+	Skipped  int            `json:"skipped"`
+	Results  []ImportResult `json:"results"`
+}
+
+// Problem is an RFC 7807 error response of the versioned API, Code being a stable machine-readable reason
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	ShortURL string       `json:"short_url,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes why a single field of a request is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,201 @@
+// Package qrcode renders QR codes for short links as PNG or SVG images.
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+// Supported output formats
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+)
+
+// Limits and defaults for rendering options
+const (
+	DefaultSize   = 256
+	MinSize       = 32
+	MaxSize       = 2048
+	DefaultMargin = 4
+	MaxMargin     = 32
+)
+
+// Package level errors for QR code rendering
+var (
+	ErrorFormat = errors.New("unsupported QR code format")
+	ErrorSize   = errors.New("QR code size out of range")
+	ErrorMargin = errors.New("QR code margin out of range")
+	ErrorLevel  = errors.New("unknown error correction level")
+	ErrorColor  = errors.New("malformed color")
+)
+
+// Options control how a QR code is rendered
+type Options struct {
+	Format     string      // Output format, png or svg
+	Size       int         // Image width and height in pixels
+	Margin     int         // Quiet zone width in modules
+	Level      qr.Level    // Error correction level
+	Foreground color.NRGBA // Color of dark modules
+	Background color.NRGBA // Color of light modules and the quiet zone
+}
+
+// DefaultOptions returns a black on white 256px PNG with medium error correction
+func DefaultOptions() Options {
+	return Options{
+		Format:     FormatPNG,
+		Size:       DefaultSize,
+		Margin:     DefaultMargin,
+		Level:      qr.M,
+		Foreground: color.NRGBA{A: 0xFF},
+		Background: color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF},
+	}
+}
+
+// ContentType returns the MIME type of the configured output format
+func (o Options) ContentType() string {
+	if o.Format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// Validate checks that all options are within the supported ranges
+func (o Options) Validate() error {
+	if o.Format != FormatPNG && o.Format != FormatSVG {
+		return ErrorFormat
+	}
+	if o.Size < MinSize || o.Size > MaxSize {
+		return ErrorSize
+	}
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return ErrorMargin
+	}
+	if o.Level < qr.L || o.Level > qr.H {
+		return ErrorLevel
+	}
+	return nil
+}
+
+// ParseLevel converts L, M, Q or H into an error correction level
+func ParseLevel(s string) (qr.Level, error) {
+	switch strings.ToUpper(s) {
+	case "L":
+		return qr.L, nil
+	case "M":
+		return qr.M, nil
+	case "Q":
+		return qr.Q, nil
+	case "H":
+		return qr.H, nil
+	}
+	return 0, ErrorLevel
+}
+
+// ParseColor converts a hex color in RGB, RRGGBB or RRGGBBAA form, with an optional leading #
+func ParseColor(s string) (color.NRGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	if len(s) != 8 {
+		return color.NRGBA{}, ErrorColor
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, ErrorColor
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// Render encodes content as a QR code and writes the image to w
+func Render(w io.Writer, content string, opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	code, err := qr.Encode(content, opts.Level)
+	if err != nil {
+		return err
+	}
+
+	if opts.Format == FormatSVG {
+		return renderSVG(w, code, opts)
+	}
+	return renderPNG(w, code, opts)
+}
+
+// renderPNG draws the code with whole-pixel modules centred on a Size x Size canvas
+func renderPNG(w io.Writer, code *qr.Code, opts Options) error {
+	modules := code.Size + 2*opts.Margin
+	scale := max(opts.Size/modules, 1)
+	size := max(opts.Size, modules)
+	offset := (size - modules*scale) / 2
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{opts.Background, opts.Foreground})
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if !code.Black(x, y) {
+				continue
+			}
+			px := offset + (x+opts.Margin)*scale
+			py := offset + (y+opts.Margin)*scale
+			for dy := 0; dy < scale; dy++ {
+				row := img.Pix[(py+dy)*img.Stride:]
+				for dx := 0; dx < scale; dx++ {
+					row[px+dx] = 1
+				}
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// renderSVG draws the code as a single path scaled to Size x Size
+func renderSVG(w io.Writer, code *qr.Code, opts Options) error {
+	modules := code.Size + 2*opts.Margin
+
+	var path strings.Builder
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if !code.Black(x, y) {
+				continue
+			}
+			run := 1
+			for x+run < code.Size && code.Black(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", x+opts.Margin, y+opts.Margin, run, run)
+			x += run - 1
+		}
+	}
+
+	_, err := fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">
+<rect width="%d" height="%d" %s/>
+<path d="%s" %s/>
+</svg>
+`, opts.Size, opts.Size, modules, modules, modules, modules, svgFill(opts.Background), path.String(), svgFill(opts.Foreground))
+	return err
+}
+
+// svgFill formats a color as SVG fill attributes
+func svgFill(c color.NRGBA) string {
+	fill := fmt.Sprintf(`fill="#%02x%02x%02x"`, c.R, c.G, c.B)
+	if c.A != 0xFF {
+		fill += fmt.Sprintf(` fill-opacity="%.3f"`, float64(c.A)/0xFF)
+	}
+	return fill
+}
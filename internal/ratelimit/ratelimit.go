@@ -0,0 +1,140 @@
+// Package ratelimit implements token bucket rate limits kept in memory or in a shared store.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrorLimit is returned for a malformed limit
+var ErrorLimit = errors.New("rate limit must look like 100/1m")
+
+// Limit is a token bucket holding up to Burst tokens and refilled by Rate tokens per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Parse reads a limit written as requests per period, e.g. "100/1m", optionally with a burst size
+// different from the number of requests, e.g. "100/1m:20". An empty string means no limit.
+func Parse(s string) (Limit, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return Limit{}, nil
+	}
+
+	spec, burst, hasBurst := strings.Cut(s, ":")
+	count, period, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, ErrorLimit
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return Limit{}, ErrorLimit
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, ErrorLimit
+	}
+
+	l := Limit{Rate: float64(n) / d.Seconds(), Burst: n}
+	if hasBurst {
+		if l.Burst, err = strconv.Atoi(burst); err != nil || l.Burst <= 0 {
+			return Limit{}, ErrorLimit
+		}
+	}
+	return l, nil
+}
+
+// Enabled reports whether the limit restricts anything
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Result describes the bucket of a key after taking a token
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store takes tokens from the buckets of keys. The in-memory Memory limits a single instance,
+// implementations backed by a shared store can limit all instances together.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// bucket is the state of a single key
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+// Memory keeps buckets in memory, dropping those that have refilled
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	purged  time.Time
+}
+
+// NewMemory creates an empty in-memory Store
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket), purged: time.Now()}
+}
+
+// Take takes a token from the bucket of key, refilling it for the time passed since the last request
+func (m *Memory) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+	burst := float64(limit.Burst)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.purge(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, updated: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+
+	res := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((burst - b.tokens) / limit.Rate)
+	b.full = now.Add(res.Reset)
+	return res, nil
+}
+
+// purge drops buckets that have refilled, at most once a minute
+func (m *Memory) purge(now time.Time) {
+	if now.Sub(m.purged) < time.Minute {
+		return
+	}
+	m.purged = now
+
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// seconds converts a number of seconds to a duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,84 @@
+package redirect
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"url-shortener/internal/models"
+)
+
+// DefaultUnfurlers are User-Agent substrings of bots that unfurl links into previews
+var DefaultUnfurlers = []string{
+	"Slackbot", "Twitterbot", "facebookexternalhit", "LinkedInBot", "Discordbot", "TelegramBot",
+	"WhatsApp", "SkypeUriPreview", "Pinterestbot", "redditbot", "Embedly", "vkShare", "Mastodon",
+}
+
+// Limits of the social card fields set by link owners
+const (
+	maxCardTitle       = 200
+	maxCardDescription = 1000
+)
+
+// Package level errors for social card validation
+var (
+	ErrorCardTitle       = errors.New("card title is too long")
+	ErrorCardDescription = errors.New("card description is too long")
+	ErrorCardImage       = errors.New("card image must be absolute http(s)")
+)
+
+// IsUnfurler reports whether a User-Agent contains one of the given substrings, compared case-insensitively
+func IsUnfurler(ua string, agents []string) bool {
+	lower := strings.ToLower(ua)
+	for _, a := range agents {
+		if a != "" && strings.Contains(lower, strings.ToLower(a)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateCard checks the owner's social card overrides before they are stored
+func ValidateCard(card models.Card) error {
+	if len(card.Title) > maxCardTitle {
+		return ErrorCardTitle
+	}
+	if len(card.Description) > maxCardDescription {
+		return ErrorCardDescription
+	}
+	if card.Image != "" {
+		u, err := url.Parse(card.Image)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrorCardImage
+		}
+	}
+	return nil
+}
+
+// CardFor builds the social card of a link, preferring the owner's overrides, then the link's
+// title and description, then the metadata fetched from the destination page
+func CardFor(rec models.URLRecord) models.Card {
+	var res models.Card
+	if rec.Card != nil {
+		res = *rec.Card
+	}
+
+	meta := models.Metadata{}
+	if rec.Metadata != nil {
+		meta = *rec.Metadata
+	}
+
+	res.Title = first(res.Title, rec.Title, meta.OGTitle, meta.Title, rec.URL)
+	res.Description = first(res.Description, rec.Description, meta.OGDescription)
+	res.Image = first(res.Image, meta.OGImage)
+	return res
+}
+
+// first returns the first non-empty string
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
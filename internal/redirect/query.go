@@ -0,0 +1,146 @@
+// Package redirect builds the final destination of a short link at redirect time.
+package redirect
+
+import (
+	"net/url"
+	"strings"
+	"url-shortener/internal/models"
+)
+
+// param is a single query parameter with its decoded key and raw encoded form
+type param struct {
+	key string
+	raw string
+}
+
+// Destination returns the redirect target for a visit and the A/B variant serving it.
+// The target is picked by Target, then the incoming query is merged according to the
+// link's query policy and its default UTM parameters are appended. The target is
+// returned untouched when nothing has to be added.
+func Destination(rec models.URLRecord, v models.Visit) (string, string, error) {
+	target, variant := Target(rec, v)
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", variant, err
+	}
+
+	params := parseQuery(u.RawQuery, false)
+	changed := false
+
+	incoming := parseQuery(v.RawQuery, true)
+	if len(incoming) > 0 {
+		switch rec.QueryPolicy {
+		case models.QueryAppend:
+			params = append(params, incoming...)
+			changed = true
+		case models.QueryOverride:
+			params = override(params, incoming)
+			changed = true
+		}
+	}
+
+	for _, p := range utmParams(rec.UTM) {
+		if !hasKey(params, p.key) {
+			params = append(params, p)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return target, variant, nil
+	}
+
+	u.RawQuery = encodeQuery(params)
+	return u.String(), variant, nil
+}
+
+// parseQuery splits a raw query into ordered parameters. Destination parameters keep
+// their original encoding, while incoming ones are decoded and re-encoded so that
+// malformed input can't leak into the redirect.
+func parseQuery(rawQuery string, normalize bool) []param {
+	var params []param
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+
+		rawKey, rawValue, hasValue := strings.Cut(part, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			if normalize {
+				continue
+			}
+			key = rawKey
+		}
+
+		if normalize {
+			value, err := url.QueryUnescape(rawValue)
+			if err != nil || key == "" {
+				continue
+			}
+			part = url.QueryEscape(key)
+			if hasValue {
+				part += "=" + url.QueryEscape(value)
+			}
+		}
+		params = append(params, param{key: key, raw: part})
+	}
+	return params
+}
+
+// override replaces destination parameters with incoming ones sharing the same key
+func override(params, incoming []param) []param {
+	replaced := make(map[string]bool, len(incoming))
+	for _, p := range incoming {
+		replaced[p.key] = true
+	}
+
+	res := make([]param, 0, len(params)+len(incoming))
+	for _, p := range params {
+		if !replaced[p.key] {
+			res = append(res, p)
+		}
+	}
+	return append(res, incoming...)
+}
+
+// utmParams converts link-level UTM defaults into query parameters
+func utmParams(utm *models.UTM) []param {
+	if utm == nil {
+		return nil
+	}
+
+	var params []param
+	for _, kv := range [][2]string{
+		{"utm_source", utm.Source},
+		{"utm_medium", utm.Medium},
+		{"utm_campaign", utm.Campaign},
+		{"utm_term", utm.Term},
+		{"utm_content", utm.Content},
+	} {
+		if kv[1] != "" {
+			params = append(params, param{key: kv[0], raw: kv[0] + "=" + url.QueryEscape(kv[1])})
+		}
+	}
+	return params
+}
+
+// hasKey reports whether a parameter with the given key is present
+func hasKey(params []param, key string) bool {
+	for _, p := range params {
+		if p.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeQuery joins ordered parameters back into a raw query
+func encodeQuery(params []param) string {
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.raw
+	}
+	return strings.Join(parts, "&")
+}
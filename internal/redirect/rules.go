@@ -0,0 +1,219 @@
+package redirect
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"url-shortener/internal/models"
+)
+
+// MaxRules limits the number of redirect rules per link
+const MaxRules = 32
+
+// Package level errors for redirect rule validation
+var (
+	ErrorTooManyRules = errors.New("too many redirect rules")
+	ErrorRuleEmpty    = errors.New("redirect rule has no conditions")
+	ErrorRuleURL      = errors.New("redirect rule URL must be absolute http(s)")
+	ErrorRuleOS       = errors.New("unknown operating system in redirect rule")
+	ErrorRuleDevice   = errors.New("unknown device class in redirect rule")
+	ErrorRuleCountry  = errors.New("malformed country code in redirect rule")
+	ErrorRuleTime     = errors.New("malformed time window in redirect rule")
+	ErrorRuleTimezone = errors.New("unknown time zone in redirect rule")
+)
+
+var (
+	knownOS      = []string{OSiOS, OSAndroid, OSWindows, OSMacOS, OSChromeOS, OSLinux}
+	knownDevices = []string{DeviceMobile, DeviceTablet, DeviceDesktop, DeviceBot}
+)
+
+// Target returns the URL a visit should be sent to before query merging and the variant
+// serving it: the first matching rule's destination, the visit's A/B variant, or the
+// record's own URL. The variant is empty unless the visit is served by one.
+func Target(rec models.URLRecord, v models.Visit) (string, string) {
+	if rule, ok := Match(rec.Rules, v); ok {
+		return rule.URL, ""
+	}
+	if u, ok := variantURL(rec.Variants, v.Variant); ok {
+		return u, v.Variant
+	}
+	return rec.URL, ""
+}
+
+// Match returns the first rule whose conditions all hold for the visit
+func Match(rules []models.Rule, v models.Visit) (models.Rule, bool) {
+	if len(rules) == 0 {
+		return models.Rule{}, false
+	}
+
+	os, device := ParseUserAgent(v.UserAgent)
+	lang := PreferredLanguage(v.AcceptLanguage)
+
+	for _, rule := range rules {
+		if len(rule.OS) > 0 && !slices.Contains(rule.OS, os) {
+			continue
+		}
+		if len(rule.Device) > 0 && !slices.Contains(rule.Device, device) {
+			continue
+		}
+		if len(rule.Language) > 0 && !matchLanguage(rule.Language, lang) {
+			continue
+		}
+		if len(rule.Country) > 0 && !slices.ContainsFunc(rule.Country, func(c string) bool {
+			return strings.EqualFold(c, v.Country)
+		}) {
+			continue
+		}
+		if (rule.From != "" || rule.To != "") && !inWindow(rule, v.Time) {
+			continue
+		}
+		return rule, true
+	}
+	return models.Rule{}, false
+}
+
+// ValidateRules checks that rules are well formed before they are stored
+func ValidateRules(rules []models.Rule) error {
+	if len(rules) > MaxRules {
+		return ErrorTooManyRules
+	}
+
+	for _, rule := range rules {
+		u, err := url.Parse(rule.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrorRuleURL
+		}
+		if len(rule.OS) == 0 && len(rule.Device) == 0 && len(rule.Language) == 0 && len(rule.Country) == 0 &&
+			rule.From == "" && rule.To == "" {
+			return ErrorRuleEmpty
+		}
+		for _, os := range rule.OS {
+			if !slices.Contains(knownOS, os) {
+				return ErrorRuleOS
+			}
+		}
+		for _, device := range rule.Device {
+			if !slices.Contains(knownDevices, device) {
+				return ErrorRuleDevice
+			}
+		}
+		for _, country := range rule.Country {
+			if len(country) != 2 || strings.Trim(strings.ToUpper(country), "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+				return ErrorRuleCountry
+			}
+		}
+		if rule.From != "" || rule.To != "" {
+			if _, err := minuteOfDay(rule.From); err != nil {
+				return ErrorRuleTime
+			}
+			if _, err := minuteOfDay(rule.To); err != nil {
+				return ErrorRuleTime
+			}
+		}
+		if rule.Timezone != "" {
+			if _, err := location(rule.Timezone); err != nil {
+				return ErrorRuleTimezone
+			}
+		}
+	}
+	return nil
+}
+
+// PreferredLanguage returns the highest weighted language tag of an Accept-Language header
+func PreferredLanguage(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		if q > bestQ {
+			best, bestQ = tag, q
+		}
+	}
+	return strings.ToLower(best)
+}
+
+// matchLanguage reports whether lang equals one of the tags or is a subtag of one, so "de" matches "de-AT"
+func matchLanguage(tags []string, lang string) bool {
+	if lang == "" {
+		return false
+	}
+	for _, tag := range tags {
+		tag = strings.ToLower(tag)
+		if lang == tag || strings.HasPrefix(lang, tag+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// inWindow reports whether t falls into the rule's time of day window, which may wrap past midnight
+func inWindow(rule models.Rule, t time.Time) bool {
+	from, err := minuteOfDay(rule.From)
+	if err != nil {
+		return false
+	}
+	to, err := minuteOfDay(rule.To)
+	if err != nil {
+		return false
+	}
+
+	loc, err := location(rule.Timezone)
+	if err != nil {
+		return false
+	}
+
+	t = t.In(loc)
+	now := t.Hour()*60 + t.Minute()
+	if from <= to {
+		return from <= now && now < to
+	}
+	return now >= from || now < to
+}
+
+// locations caches time zones by name, they are loaded when a rule is validated
+// and reused on every redirect instead of reading the zone database each time
+var locations sync.Map
+
+// location returns the named time zone, UTC when the name is empty
+func location(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// minuteOfDay parses an HH:MM time, treating an empty value as the start or end of the day
+func minuteOfDay(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
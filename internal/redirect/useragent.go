@@ -0,0 +1,62 @@
+package redirect
+
+import "strings"
+
+// Operating systems recognised in User-Agent headers
+const (
+	OSiOS      = "ios"
+	OSAndroid  = "android"
+	OSWindows  = "windows"
+	OSMacOS    = "macos"
+	OSChromeOS = "chromeos"
+	OSLinux    = "linux"
+)
+
+// Device classes recognised in User-Agent headers
+const (
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+	DeviceBot     = "bot"
+)
+
+// botMarkers are User-Agent substrings identifying crawlers and link unfurlers
+var botMarkers = []string{"bot", "crawler", "spider", "slurp", "facebookexternalhit", "embedly", "curl/", "wget/"}
+
+// ParseUserAgent classifies a User-Agent header into an operating system and a device class.
+// The operating system is empty when it can't be recognised.
+func ParseUserAgent(ua string) (os, device string) {
+	lower := strings.ToLower(ua)
+
+	switch {
+	case strings.Contains(lower, "iphone"), strings.Contains(lower, "ipad"), strings.Contains(lower, "ipod"):
+		os = OSiOS
+	case strings.Contains(lower, "android"):
+		os = OSAndroid
+	case strings.Contains(lower, "windows"):
+		os = OSWindows
+	case strings.Contains(lower, "cros "): // the CrOS platform token, not "microsoft"
+		os = OSChromeOS
+	case strings.Contains(lower, "macintosh"), strings.Contains(lower, "mac os x"):
+		os = OSMacOS
+	case strings.Contains(lower, "linux"):
+		os = OSLinux
+	}
+
+	for _, marker := range botMarkers {
+		if strings.Contains(lower, marker) {
+			return os, DeviceBot
+		}
+	}
+
+	switch {
+	case strings.Contains(lower, "ipad"), strings.Contains(lower, "tablet"),
+		os == OSAndroid && !strings.Contains(lower, "mobile"):
+		device = DeviceTablet
+	case strings.Contains(lower, "mobi"), strings.Contains(lower, "iphone"), strings.Contains(lower, "ipod"):
+		device = DeviceMobile
+	default:
+		device = DeviceDesktop
+	}
+	return os, device
+}
@@ -0,0 +1,122 @@
+package redirect
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/url"
+	"url-shortener/internal/models"
+)
+
+// Limits for A/B split variants
+const (
+	MaxVariants  = 10
+	MaxWeight    = 1000
+	maxVariantID = 32
+)
+
+// Package level errors for variant validation
+var (
+	ErrorTooManyVariants = errors.New("too many variants")
+	ErrorVariantID       = errors.New("variant ID must be 1-32 letters, digits, '-' or '_'")
+	ErrorVariantDup      = errors.New("duplicate variant ID")
+	ErrorVariantURL      = errors.New("variant URL must be absolute http(s)")
+	ErrorVariantWeight   = errors.New("variant weight out of range")
+	ErrorNoTraffic       = errors.New("at least one variant needs a positive weight")
+	ErrorWinner          = errors.New("winner is not one of the variants")
+)
+
+// PickVariant chooses the variant serving a visitor: the declared winner, the variant
+// remembered in the visitor's cookie while it still receives traffic, or a weighted
+// random one. It returns an empty string for links without variants.
+func PickVariant(rec models.URLRecord, sticky string) string {
+	if len(rec.Variants) == 0 {
+		return ""
+	}
+
+	if rec.Winner != "" {
+		return rec.Winner
+	}
+
+	total := 0
+	for _, x := range rec.Variants {
+		if x.ID == sticky && x.Weight > 0 {
+			return sticky
+		}
+		total += x.Weight
+	}
+
+	if total <= 0 {
+		return ""
+	}
+
+	n := rand.IntN(total)
+	for _, x := range rec.Variants {
+		if n < x.Weight {
+			return x.ID
+		}
+		n -= x.Weight
+	}
+	return ""
+}
+
+// variantURL returns the destination of the variant with the given ID
+func variantURL(variants []models.Variant, id string) (string, bool) {
+	if id == "" {
+		return "", false
+	}
+	for _, x := range variants {
+		if x.ID == id {
+			return x.URL, true
+		}
+	}
+	return "", false
+}
+
+// ValidateVariants checks that variants and the declared winner are well formed before they are stored
+func ValidateVariants(variants []models.Variant, winner string) error {
+	if len(variants) > MaxVariants {
+		return ErrorTooManyVariants
+	}
+
+	seen := make(map[string]bool, len(variants))
+	total := 0
+	for _, x := range variants {
+		if !validVariantID(x.ID) {
+			return ErrorVariantID
+		}
+		if seen[x.ID] {
+			return ErrorVariantDup
+		}
+		seen[x.ID] = true
+
+		u, err := url.Parse(x.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrorVariantURL
+		}
+		if x.Weight < 0 || x.Weight > MaxWeight {
+			return ErrorVariantWeight
+		}
+		total += x.Weight
+	}
+
+	if len(variants) > 0 && total == 0 && winner == "" {
+		return ErrorNoTraffic
+	}
+	if winner != "" && !seen[winner] {
+		return ErrorWinner
+	}
+	return nil
+}
+
+// validVariantID reports whether id is safe to store in a cookie
+func validVariantID(id string) bool {
+	if id == "" || len(id) > maxVariantID {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
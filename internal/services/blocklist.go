@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"url-shortener/internal/models"
+	"url-shortener/internal/storage"
+	"url-shortener/internal/tracing"
+)
+
+// Blocker matches destination URLs against a blocklist that can be extended at runtime
+type Blocker interface {
+	Blocked(url string) (string, bool)
+	Add(entry string) error
+}
+
+// ThreatChecker matches URLs against hash-prefix threat lists
+type ThreatChecker interface {
+	Check(url string) (string, bool)
+}
+
+// blocked reports whether any destination of a link is on the blocklist or a threat list
+func (s *URLs) blocked(rec models.URLRecord) bool {
+	for _, url := range destinations(rec) {
+		if s.listed(url) || s.Threat(url) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// listed reports whether a URL is on the blocklist
+func (s *URLs) listed(url string) bool {
+	if s.Blocklist == nil {
+		return false
+	}
+	_, ok := s.Blocklist.Blocked(url)
+	return ok
+}
+
+// Threat returns the threat type of a URL found on a threat list, or an empty string if it is not flagged
+func (s *URLs) Threat(url string) string {
+	if s.Threats == nil {
+		return ""
+	}
+	threat, ok := s.Threats.Check(url)
+	if ok && threat == "" {
+		return "THREAT_TYPE_UNSPECIFIED"
+	}
+	return threat
+}
+
+// blockedByList reports whether any destination of a link is on the blocklist
+func (s *URLs) blockedByList(rec models.URLRecord) bool {
+	for _, url := range destinations(rec) {
+		if s.listed(url) {
+			return true
+		}
+	}
+	return false
+}
+
+// destinations lists every URL a link can redirect to
+func destinations(rec models.URLRecord) []string {
+	res := []string{rec.URL}
+	for _, r := range rec.Rules {
+		res = append(res, r.URL)
+	}
+	for _, v := range rec.Variants {
+		res = append(res, v.URL)
+	}
+	return res
+}
+
+// Block adds an entry to the blocklist and disables every existing link with a matching destination.
+// It returns the number of links disabled.
+func (s *URLs) Block(ctx context.Context, entry string) (int, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "URLs.Block")
+	defer span.End()
+
+	if s.Blocklist == nil {
+		return 0, ErrorNoBlocklist
+	}
+
+	if err := s.Blocklist.Add(entry); err != nil {
+		return 0, err
+	}
+
+	var recs []models.URLRecord
+	if s.Storage.DB != nil {
+		err := s.Storage.EachActive(ctx, func(page []models.URLRecord) error {
+			for _, rec := range page {
+				if s.blockedByList(rec) {
+					recs = append(recs, rec)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		tx, err := s.Storage.DB.BeginTx(ctx, &sql.TxOptions{})
+		if err != nil {
+			return 0, err
+		}
+		defer tx.Rollback()
+
+		if err = s.Storage.Disable(ctx, tx, recs); err != nil {
+			return 0, err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+
+	s.MU.Lock()
+	defer s.MU.Unlock()
+
+	if s.Storage.DB == nil {
+		for _, rec := range s.Storage.URLs {
+			if !rec.Deleted && !rec.Disabled && s.blockedByList(rec) {
+				recs = append(recs, rec)
+			}
+		}
+	}
+
+	for _, rec := range recs {
+		rec.Disabled = true
+		if err := s.Encoder.Encode(rec); err != nil {
+			return 0, err
+		}
+		s.Storage.URLs[storage.Key(rec.Domain, rec.ShortURL)] = rec
+	}
+	return len(recs), nil
+}
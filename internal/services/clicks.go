@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"net"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/storage"
+	"url-shortener/internal/tracing"
+)
+
+// Locator resolves client IP addresses to ISO country codes
+type Locator interface {
+	Country(ip net.IP) string
+}
+
+// clickBatchSize is the number of queued clicks written to the database in one statement
+const clickBatchSize = 100
+
+// Country returns the country code of a client IP, or an empty string without a GeoIP database
+func (s *URLs) Country(ip string) string {
+	if s.Geo == nil {
+		return ""
+	}
+	return s.Geo.Country(net.ParseIP(ip))
+}
+
+// RecordClick registers a redirect in the click analytics without blocking the redirect
+func (s *URLs) RecordClick(ctx context.Context, click models.Click) {
+	if s.Storage.DB != nil {
+		select {
+		case s.clickQueue <- click:
+		default:
+			s.Log.Warn("Click queue full, dropping click", "shortURL", click.ShortURL)
+		}
+		return
+	}
+
+	key := storage.Key(click.Domain, click.ShortURL)
+
+	s.ClicksMU.Lock()
+	defer s.ClicksMU.Unlock()
+
+	stats, ok := s.Clicks[key]
+	if !ok {
+		stats = &models.ClickStats{Countries: map[string]int{}, Variants: map[string]int{}}
+		s.Clicks[key] = stats
+	}
+	stats.Clicks++
+	if click.Country != "" {
+		stats.Countries[click.Country]++
+	}
+	if click.Variant != "" {
+		stats.Variants[click.Variant]++
+	}
+}
+
+// GetClickStats returns the click analytics of a link owned by userID, broken down by country and variant
+func (s *URLs) GetClickStats(ctx context.Context, userID, domain, shortURL string) (models.ClickStats, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "URLs.GetClickStats")
+	defer span.End()
+
+	res := models.ClickStats{Countries: map[string]int{}, Variants: map[string]int{}}
+
+	rec, err := s.GetURL(ctx, domain, shortURL)
+	if err != nil {
+		return res, err
+	}
+
+	if rec.UserID != userID {
+		return res, ErrorForbidden
+	}
+
+	if s.Storage.DB != nil {
+		return s.Storage.ClickStats(ctx, domain, shortURL)
+	}
+
+	s.ClicksMU.RLock()
+	defer s.ClicksMU.RUnlock()
+
+	if stats, ok := s.Clicks[storage.Key(domain, shortURL)]; ok {
+		res.Clicks = stats.Clicks
+		for country, n := range stats.Countries {
+			res.Countries[country] = n
+		}
+		for variant, n := range stats.Variants {
+			res.Variants[variant] = n
+		}
+	}
+	return res, nil
+}
+
+// processClicks writes queued clicks to the database in batches until ctx is cancelled
+func (s *URLs) processClicks(ctx context.Context) {
+	var buffer []models.Click
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(buffer) == 0 {
+			return
+		}
+		if err := s.Storage.SaveClicks(context.Background(), s.Storage.DB, buffer); err != nil {
+			s.Log.Error("Failed to save clicks", "error", err, "count", len(buffer))
+		}
+		buffer = buffer[:0]
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case x := <-s.clickQueue:
+					buffer = append(buffer, x)
+				default:
+					flush()
+					return
+				}
+			}
+
+		case x := <-s.clickQueue:
+			buffer = append(buffer, x)
+			if len(buffer) >= clickBatchSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
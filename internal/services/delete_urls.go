@@ -4,18 +4,28 @@ import (
 	"context"
 	"sync"
 	"time"
+	"url-shortener/internal/metrics"
 	"url-shortener/internal/models"
+	"url-shortener/internal/tracing"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
-// DeleteURLs processes a batch of URLs for deletion for a specific user
-func (s *URLs) DeleteURLs(req []string, userID string) error {
-	ctx := context.Background()
+// DeleteURLs processes a batch of URLs for deletion for a specific user on a domain
+func (s *URLs) DeleteURLs(req []string, userID, domain string) error {
+	ctx, span := tracing.Tracer().Start(context.Background(), "URLs.DeleteURLs")
+	defer span.End()
 	ch := make(chan models.DeleteRecord, len(req))
 	defer close(ch)
 
+	// the links count as queued until processing returns, committed or not
+	metrics.DeleteQueue.Add(float64(len(req)))
+	defer metrics.DeleteQueue.Sub(float64(len(req)))
+
 	for _, x := range req {
 		del := models.DeleteRecord{
 			UserID:   userID,
+			Domain:   domain,
 			ShortURL: x,
 		}
 		ch <- del
@@ -94,6 +104,8 @@ func (s *URLs) processURLs(ctx context.Context, chs ...chan models.DeleteRecord)
 func (s *URLs) commitDB(ctx context.Context, records []models.DeleteRecord) error {
 	db := s.Storage.DB
 	if db != nil {
+		defer prometheus.NewTimer(metrics.DeleteCommitDuration).ObserveDuration()
+
 		tx, err := s.Storage.DB.BeginTx(ctx, nil)
 		if err != nil {
 			return err
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"url-shortener/internal/models"
+	"url-shortener/internal/tracing"
+)
+
+// DefaultDomain returns the short domain a user's new links are created on, "" for the default BaseURL
+func (s *URLs) DefaultDomain(ctx context.Context, userID string) (string, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "URLs.DefaultDomain")
+	defer span.End()
+
+	if s.Storage.DB != nil {
+		return s.Storage.UserDomain(ctx, userID)
+	}
+
+	s.MU.RLock()
+	defer s.MU.RUnlock()
+	return s.Storage.Domains[userID], nil
+}
+
+// SetDefaultDomain chooses the short domain a user's new links are created on. Without a database
+// the choice is appended to the file storage as a settings record, which is replayed on load.
+func (s *URLs) SetDefaultDomain(ctx context.Context, userID, domain string) error {
+	ctx, span := tracing.Tracer().Start(ctx, "URLs.SetDefaultDomain")
+	defer span.End()
+
+	if s.Storage.DB != nil {
+		return s.Storage.SetUserDomain(ctx, userID, domain)
+	}
+
+	s.MU.Lock()
+	defer s.MU.Unlock()
+	err := s.Encoder.Encode(models.SettingsRecord{Settings: &models.UserSettings{UserID: userID, DefaultDomain: domain}})
+	if err != nil {
+		return err
+	}
+	s.Storage.Domains[userID] = domain
+	return nil
+}
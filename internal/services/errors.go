@@ -6,6 +6,18 @@ import (
 
 // Package level errors for the URL shortener service layer
 var (
-	ErrorNotFound = errors.New("error finding URL")
-	ErrorNoDB     = errors.New("error connecting DB")
+	ErrorNotFound        = errors.New("error finding URL")
+	ErrorNoDB            = errors.New("error connecting DB")
+	ErrorForbidden       = errors.New("URL belongs to another user")
+	ErrorInvalidSettings = errors.New("invalid link settings")
+	ErrorInvalidURL      = errors.New("malformed URL")
+	ErrorBlocked         = errors.New("destination is blocked")
+	ErrorNoBlocklist     = errors.New("blocklist is not configured")
+	ErrorSelfReference   = errors.New("URL points to this service")
+	ErrorRedirectChain   = errors.New("redirect chain is too long")
+	ErrorInvalidAlias    = errors.New("alias must be 1-64 letters, digits, '-' or '_'")
+	ErrorAliasTaken      = errors.New("short URL is already taken")
+	ErrorReservedAlias   = errors.New("alias is reserved for a route")
+	ErrorInvalidTags     = errors.New("too many or too long tags")
+	ErrorExpired         = errors.New("expiry is in the past")
 )
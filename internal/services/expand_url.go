@@ -0,0 +1,22 @@
+package services
+
+import (
+	"context"
+	"url-shortener/internal/tracing"
+)
+
+// Expander resolves a link of an external URL shortener to the URL it redirects to
+type Expander interface {
+	Expand(ctx context.Context, url string) (string, error)
+}
+
+// ExpandURL follows a single redirect of a known external shortener, returning url unchanged for other links
+func (s *URLs) ExpandURL(ctx context.Context, url string) (string, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "URLs.ExpandURL")
+	defer span.End()
+
+	if s.Expander == nil {
+		return url, nil
+	}
+	return s.Expander.Expand(ctx, url)
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"url-shortener/internal/models"
+	"url-shortener/internal/storage"
+	"url-shortener/internal/tracing"
+)
+
+// ExportURLs passes every link of a user, deleted ones included, to fn in creation order.
+// The database is read row by row; in file mode the user's records are copied before fn is called
+// so that slow consumers don't hold the service lock.
+func (s *URLs) ExportURLs(ctx context.Context, userID string, fn func(models.ExportURL) error) error {
+	ctx, span := tracing.Tracer().Start(ctx, "URLs.ExportURLs")
+	defer span.End()
+
+	if s.Storage.DB != nil {
+		return s.Storage.Export(ctx, userID, func(rec models.URLRecord, clicks int) error {
+			return fn(models.ExportURL{UserURLResponse: rec.UserURL(), Deleted: rec.Deleted, Clicks: clicks})
+		})
+	}
+
+	var res []models.ExportURL
+
+	s.MU.RLock()
+	for key, rec := range s.Storage.URLs {
+		if rec.UserID != userID {
+			continue
+		}
+		if h, ok := s.Health[key]; ok {
+			rec.Health = &h
+		}
+		res = append(res, models.ExportURL{UserURLResponse: rec.UserURL(), Deleted: rec.Deleted})
+	}
+	s.MU.RUnlock()
+
+	s.ClicksMU.RLock()
+	for i, x := range res {
+		if stats, ok := s.Clicks[storage.Key(x.Domain, x.ShortURL)]; ok {
+			res[i].Clicks = stats.Clicks
+		}
+	}
+	s.ClicksMU.RUnlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].CreatedAt.Equal(res[j].CreatedAt) {
+			return res[i].CreatedAt.Before(res[j].CreatedAt)
+		}
+		return storage.Key(res[i].Domain, res[i].ShortURL) < storage.Key(res[j].Domain, res[j].ShortURL)
+	})
+
+	for _, x := range res {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
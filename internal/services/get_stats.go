@@ -3,10 +3,14 @@ package services
 import (
 	"context"
 	"url-shortener/internal/models"
+	"url-shortener/internal/tracing"
 )
 
 // GetStats returns user service statistics
 func (s *URLs) GetStats(ctx context.Context) (models.Stats, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "URLs.GetStats")
+	defer span.End()
+
 	var res models.Stats
 
 	if s.Storage.DB == nil {
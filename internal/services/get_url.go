@@ -2,23 +2,28 @@ package services
 
 import (
 	"context"
+	"url-shortener/internal/models"
+	"url-shortener/internal/storage"
+	"url-shortener/internal/tracing"
 )
 
-// GetURL retrieves the original URL from storage using the shortened URL as a key
-func (s *URLs) GetURL(ctx context.Context, shortURL string) (string, error) {
+// GetURL retrieves the URL record from storage using the domain and shortened URL as a key
+func (s *URLs) GetURL(ctx context.Context, domain, shortURL string) (models.URLRecord, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "URLs.GetURL")
+	defer span.End()
+
 	if s.Storage.DB != nil {
-		url, err := s.Storage.Get(ctx, shortURL)
-		if err != nil {
-			return url, err
-		}
+		return s.Storage.Get(ctx, domain, shortURL)
 	}
 
 	s.MU.RLock()
-	url, ok := s.Storage.URLs[shortURL]
+	rec, ok := s.Storage.URLs[storage.Key(domain, shortURL)]
 	s.MU.RUnlock()
-	if ok {
-		return url.URL, nil
-	} else {
-		return "", ErrorNotFound
+	if !ok {
+		return rec, ErrorNotFound
+	}
+	if rec.Deleted {
+		return rec, storage.ErrorURLDeleted
 	}
+	return rec, nil
 }
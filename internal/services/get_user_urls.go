@@ -2,17 +2,49 @@ package services
 
 import (
 	"context"
+	"sort"
 	"url-shortener/internal/models"
+	"url-shortener/internal/storage"
+	"url-shortener/internal/tracing"
 )
 
 // GetUserURLs retrieves all shortened URLs associated with a specific user ID
 func (s *URLs) GetUserURLs(ctx context.Context, userID string, res *[]models.UserURLResponse) error {
+	ctx, span := tracing.Tracer().Start(ctx, "URLs.GetUserURLs")
+	defer span.End()
+
 	db := s.Storage.DB
 	if db != nil {
 		err := s.Storage.GetMultiple(ctx, userID, res)
 		if err != nil {
 			return err
 		}
+		return nil
+	}
+
+	s.MU.RLock()
+	defer s.MU.RUnlock()
+
+	var recs []models.URLRecord
+	for key, rec := range s.Storage.URLs {
+		if rec.UserID != userID {
+			continue
+		}
+		if h, ok := s.Health[key]; ok {
+			rec.Health = &h
+		}
+		recs = append(recs, rec)
+	}
+
+	sort.Slice(recs, func(i, j int) bool {
+		if !recs[i].CreatedAt.Equal(recs[j].CreatedAt) {
+			return recs[i].CreatedAt.Before(recs[j].CreatedAt)
+		}
+		return storage.Key(recs[i].Domain, recs[i].ShortURL) < storage.Key(recs[j].Domain, recs[j].ShortURL)
+	})
+
+	for _, rec := range recs {
+		*res = append(*res, rec.UserURL())
 	}
 	return nil
 }
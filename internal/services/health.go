@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/storage"
+	"url-shortener/internal/tracing"
+)
+
+// HealthChecker checks link destinations, reporting each result with the index of its URL
+type HealthChecker interface {
+	CheckAll(ctx context.Context, urls []string, report func(i int, h models.Health))
+}
+
+// RunHealthChecks checks the destinations of all active links once per interval until ctx is cancelled
+func (s *URLs) RunHealthChecks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.CheckHealth(ctx); err != nil {
+			s.Log.Error("Failed to check link health", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckHealth checks the destinations of all links that are neither deleted nor disabled
+// and stores the results. The database is read a page of links at a time and keeps the results;
+// in file mode they are kept in memory, where links that are no longer active are dropped.
+func (s *URLs) CheckHealth(ctx context.Context) error {
+	ctx, span := tracing.Tracer().Start(ctx, "URLs.CheckHealth")
+	defer span.End()
+
+	if s.Checker == nil {
+		return nil
+	}
+
+	if s.Storage.DB != nil {
+		return s.Storage.EachActive(ctx, func(page []models.URLRecord) error {
+			s.checkHealth(ctx, page)
+			return ctx.Err()
+		})
+	}
+
+	var recs []models.URLRecord
+	s.MU.RLock()
+	for _, rec := range s.Storage.URLs {
+		if !rec.Deleted && !rec.Disabled {
+			recs = append(recs, rec)
+		}
+	}
+	s.MU.RUnlock()
+
+	s.checkHealth(ctx, recs)
+
+	s.MU.Lock()
+	for key := range s.Health {
+		if rec, ok := s.Storage.URLs[key]; !ok || rec.Deleted || rec.Disabled {
+			delete(s.Health, key)
+		}
+	}
+	s.MU.Unlock()
+	return ctx.Err()
+}
+
+// checkHealth checks the destinations of recs, saving the results to the database if there is one
+// and to the in-memory map otherwise
+func (s *URLs) checkHealth(ctx context.Context, recs []models.URLRecord) {
+	urls := make([]string, len(recs))
+	for i, rec := range recs {
+		urls[i] = rec.URL
+	}
+
+	s.Log.Info("Checking link health", "count", len(urls))
+
+	s.Checker.CheckAll(ctx, urls, func(i int, h models.Health) {
+		rec := recs[i]
+		if s.Storage.DB != nil {
+			if err := s.Storage.SetHealth(ctx, rec.Domain, rec.ShortURL, h); err != nil {
+				s.Log.Error("Failed to save link health", "error", err, "shortURL", rec.ShortURL)
+			}
+			return
+		}
+
+		s.MU.Lock()
+		s.Health[storage.Key(rec.Domain, rec.ShortURL)] = h
+		s.MU.Unlock()
+	})
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/tracing"
+)
+
+// Limits of the alias and tags of an imported link. Aliases with '-' or '_' are custom codes of up to
+// maxAlias characters; alphanumeric ones may be as long as the generated codes of long URLs, so that
+// exported short URLs can be imported again.
+const (
+	maxAlias = 64
+	maxCode  = 4096
+	maxTags  = 20
+	maxTag   = 64
+)
+
+// reservedAliases are the first path segments of the service's own routes, which an alias would shadow
+var reservedAliases = []string{"api", "ping", "swagger", "metrics", "debug"}
+
+// ImportURL creates the link of a single import row, under the row's alias if one is given.
+// It reports whether the link was created; an existing link with the same destination is returned as is.
+func (s *URLs) ImportURL(ctx context.Context, userID string, row models.ImportRow) (models.URLRecord, bool, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "URLs.ImportURL")
+	defer span.End()
+
+	now := time.Now().UTC()
+
+	if row.Alias != "" && !validAlias(row.Alias) {
+		return models.URLRecord{}, false, ErrorInvalidAlias
+	}
+	if reservedAlias(row.Alias) {
+		return models.URLRecord{}, false, ErrorReservedAlias
+	}
+
+	tags, ok := cleanTags(row.Tags)
+	if !ok {
+		return models.URLRecord{}, false, ErrorInvalidTags
+	}
+
+	if row.ExpiresAt != nil && !row.ExpiresAt.After(now) {
+		return models.URLRecord{}, false, ErrorExpired
+	}
+
+	rec, err := s.newRecord(row.URL, userID, row.Domain, now)
+	if err != nil {
+		return rec, false, err
+	}
+	if row.Alias != "" {
+		rec.ShortURL = row.Alias
+	}
+	rec.Tags = tags
+	if row.ExpiresAt != nil {
+		expiresAt := row.ExpiresAt.UTC()
+		rec.ExpiresAt = &expiresAt
+	}
+
+	return s.create(ctx, rec)
+}
+
+// validAlias reports whether a custom short code uses only URL-safe characters
+func validAlias(alias string) bool {
+	if alias == "" || len(alias) > maxCode {
+		return false
+	}
+	for _, r := range alias {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-' || r == '_':
+			if len(alias) > maxAlias {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// cleanTags trims tags and drops empty and repeated ones, rejecting too many or too long tags
+func cleanTags(tags []string) ([]string, bool) {
+	var res []string
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTag {
+			return nil, false
+		}
+		seen[tag] = true
+		res = append(res, tag)
+	}
+	return res, len(res) <= maxTags
+}
+
+// reservedAlias reports whether an alias is the first path segment of a route of the service
+func reservedAlias(alias string) bool {
+	for _, reserved := range reservedAliases {
+		if strings.EqualFold(alias, reserved) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"url-shortener/internal/models"
+	"url-shortener/internal/storage"
+)
+
+// MetadataFetcher downloads the title and Open Graph tags of a destination page
+type MetadataFetcher interface {
+	Fetch(ctx context.Context, url string) (models.Metadata, error)
+}
+
+// metadataQueueSize bounds the number of new links waiting for their metadata
+const metadataQueueSize = 256
+
+// queueMetadata schedules fetching the metadata of a new link without blocking its creation
+func (s *URLs) queueMetadata(rec models.URLRecord) {
+	if s.Fetcher == nil {
+		return
+	}
+
+	select {
+	case s.metadataQueue <- rec:
+	default:
+		s.Log.Warn("Metadata queue full, skipping link", "shortURL", rec.ShortURL)
+	}
+}
+
+// ProcessMetadata fetches the metadata of queued links with the given number of workers until ctx is cancelled
+func (s *URLs) ProcessMetadata(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case rec := <-s.metadataQueue:
+					s.fetchMetadata(ctx, rec)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// fetchMetadata fetches and stores the metadata of a single link
+func (s *URLs) fetchMetadata(ctx context.Context, rec models.URLRecord) {
+	meta, err := s.Fetcher.Fetch(ctx, rec.URL)
+	if err != nil {
+		s.Log.Warn("Failed to fetch metadata", "error", err, "shortURL", rec.ShortURL)
+		return
+	}
+
+	if s.Storage.DB != nil {
+		if err := s.Storage.SetMetadata(ctx, rec.Domain, rec.ShortURL, meta); err != nil {
+			s.Log.Error("Failed to save metadata", "error", err, "shortURL", rec.ShortURL)
+		}
+	}
+
+	key := storage.Key(rec.Domain, rec.ShortURL)
+
+	s.MU.Lock()
+	defer s.MU.Unlock()
+
+	cur, ok := s.Storage.URLs[key]
+	if !ok {
+		return
+	}
+	cur.Metadata = &meta
+	if err := s.Encoder.Encode(cur); err != nil {
+		s.Log.Error("Failed to save metadata", "error", err, "shortURL", rec.ShortURL)
+		return
+	}
+	s.Storage.URLs[key] = cur
+}
@@ -2,38 +2,154 @@ package services
 
 import (
 	"context"
+	"errors"
+	"time"
+	"url-shortener/internal/metrics"
 	"url-shortener/internal/models"
+	"url-shortener/internal/storage"
+	"url-shortener/internal/tracing"
+	"url-shortener/internal/urlnorm"
 
 	"github.com/deatil/go-encoding/base62"
 )
 
-// SaveURL creates a shortened URL from the original URL and stores it with the associated userID
-func (s *URLs) SaveURL(ctx context.Context, url, userID string) (string, error) {
-	short := base62.StdEncoding.EncodeToString([]byte(url))
+// SaveURL creates a shortened URL from the original URL and stores it with the associated userID on a domain.
+// The short URL is derived from the canonical form of the URL so that equivalent URLs share one link;
+// a URL that already has a link gets the short URL stored on it, which may be older or an alias.
+func (s *URLs) SaveURL(ctx context.Context, url, userID, domain string) (string, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "URLs.SaveURL")
+	defer span.End()
 
-	rec := models.URLRecord{
-		UserID:   userID,
-		ShortURL: short,
-		URL:      url,
+	rec, err := s.newRecord(url, userID, domain, time.Now().UTC())
+	if err != nil {
+		return "", err
 	}
 
 	if s.Storage.DB != nil {
 		err := s.Storage.Save(ctx, rec)
-		if err != nil {
-			return rec.ShortURL, err
+		switch {
+		case errors.Is(err, storage.ErrorDuplicate):
+			existing, err := s.Storage.GetCanonical(ctx, rec.Domain, rec.Canonical)
+			if err != nil {
+				return "", err
+			}
+			return existing.ShortURL, storage.ErrorDuplicate
+		case errors.Is(err, storage.ErrorShortTaken):
+			return "", ErrorAliasTaken
+		case err != nil:
+			return "", err
 		}
 	}
 
-	_, ok := s.Storage.URLs[rec.ShortURL]
-	if !ok {
-		s.MU.Lock()
+	s.MU.Lock()
+	defer s.MU.Unlock()
+
+	if short, ok := s.Storage.Canonical(rec.Domain, rec.Canonical); ok {
+		return short, nil
+	}
+	if _, ok := s.Storage.URLs[storage.Key(rec.Domain, rec.ShortURL)]; !ok {
 		err := s.Encoder.Encode(rec)
 		if err != nil {
 			return "", err
 		}
 
-		s.Storage.URLs[rec.ShortURL] = rec
-		s.MU.Unlock()
+		s.Storage.Index(rec)
+		metrics.LinksCreated.Inc()
+		s.queueMetadata(rec)
+	}
+	return rec.ShortURL, nil
+}
+
+// newRecord builds the record of a new link, keeping the exact URL for redirects and
+// deriving the short URL from its canonical form. Destinations on the blocklist or a threat list are rejected.
+func (s *URLs) newRecord(url, userID, domain string, createdAt time.Time) (models.URLRecord, error) {
+	canonical, err := urlnorm.Normalize(url, s.Normalize)
+	if err != nil {
+		return models.URLRecord{}, ErrorInvalidURL
+	}
+
+	rec := models.URLRecord{
+		UserID:    userID,
+		ShortURL:  base62.StdEncoding.EncodeToString([]byte(canonical)),
+		URL:       url,
+		Canonical: canonical,
+		Domain:    domain,
+		CreatedAt: createdAt,
+	}
+	if s.blocked(rec) {
+		return models.URLRecord{}, ErrorBlocked
+	}
+	return rec, nil
+}
+
+// create stores a new record unless its short URL is already in use. An existing link with the same
+// canonical destination is returned as is; a short URL used by another destination or by a deleted link is taken.
+func (s *URLs) create(ctx context.Context, rec models.URLRecord) (models.URLRecord, bool, error) {
+	existing, err := s.canonicalLink(ctx, rec.Domain, rec.Canonical)
+	if err == nil {
+		return existing, false, nil
+	}
+	if !errors.Is(err, storage.ErrorNotFound) {
+		return rec, false, err
+	}
+
+	existing, err = s.GetURL(ctx, rec.Domain, rec.ShortURL)
+	switch {
+	case err == nil && existing.Canonical == rec.Canonical:
+		return existing, false, nil
+	case err == nil || errors.Is(err, storage.ErrorURLDeleted):
+		return rec, false, ErrorAliasTaken
+	case !errors.Is(err, ErrorNotFound) && !errors.Is(err, storage.ErrorNotFound):
+		return rec, false, err
+	}
+
+	if s.Storage.DB != nil {
+		if err := s.Storage.Save(ctx, rec); err != nil {
+			// another request claimed the short URL or the destination between the lookups and the insert
+			if errors.Is(err, storage.ErrorShortTaken) {
+				return rec, false, ErrorAliasTaken
+			}
+			if errors.Is(err, storage.ErrorDuplicate) {
+				if existing, err := s.Storage.GetCanonical(ctx, rec.Domain, rec.Canonical); err == nil {
+					return existing, false, nil
+				}
+			}
+			return rec, false, err
+		}
+	}
+
+	key := storage.Key(rec.Domain, rec.ShortURL)
+
+	s.MU.Lock()
+	defer s.MU.Unlock()
+
+	if short, ok := s.Storage.Canonical(rec.Domain, rec.Canonical); ok {
+		return s.Storage.URLs[storage.Key(rec.Domain, short)], false, nil
+	}
+	if existing, ok := s.Storage.URLs[key]; ok {
+		return existing, false, nil
+	}
+	if err := s.Encoder.Encode(rec); err != nil {
+		return rec, false, err
+	}
+	s.Storage.Index(rec)
+	metrics.LinksCreated.Inc()
+	s.queueMetadata(rec)
+	return rec, true, nil
+}
+
+// canonicalLink returns the link a canonical URL already has on a domain, deleted links included
+func (s *URLs) canonicalLink(ctx context.Context, domain, canonical string) (models.URLRecord, error) {
+	if s.Storage.DB != nil {
+		return s.Storage.GetCanonical(ctx, domain, canonical)
+	}
+
+	s.MU.RLock()
+	defer s.MU.RUnlock()
+
+	short, ok := s.Storage.Canonical(domain, canonical)
+	if !ok {
+		return models.URLRecord{}, storage.ErrorNotFound
 	}
-	return short, nil
+	return s.Storage.URLs[storage.Key(domain, short)], nil
 }
@@ -3,13 +3,29 @@ package services
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"time"
+	"url-shortener/internal/metrics"
 	"url-shortener/internal/models"
-
-	"github.com/deatil/go-encoding/base62"
+	"url-shortener/internal/storage"
+	"url-shortener/internal/tracing"
 )
 
 // ShortenBatch processes multiple URLs in a single transaction
 func (s *URLs) ShortenBatch(ctx context.Context, userID string, req []models.BatchUnitURLRequest, res *[]models.BatchUnitURLResponse) error {
+	ctx, span := tracing.Tracer().Start(ctx, "URLs.ShortenBatch")
+	defer span.End()
+
+	createdAt := time.Now().UTC()
+	recs := make([]models.URLRecord, 0, len(req))
+	for _, x := range req {
+		rec, err := s.newRecord(x.URL, userID, x.Domain, createdAt)
+		if err != nil {
+			return err
+		}
+		recs = append(recs, rec)
+	}
+
 	if s.Storage.DB != nil {
 		tx, err := s.Storage.DB.BeginTx(ctx, &sql.TxOptions{
 			Isolation: sql.LevelSerializable,
@@ -19,7 +35,7 @@ func (s *URLs) ShortenBatch(ctx context.Context, userID string, req []models.Bat
 		}
 		defer tx.Rollback()
 
-		err = s.Storage.SaveBatch(ctx, tx, userID, req)
+		err = s.Storage.SaveBatch(ctx, tx, recs)
 		if err != nil {
 			return err
 		}
@@ -29,27 +45,119 @@ func (s *URLs) ShortenBatch(ctx context.Context, userID string, req []models.Bat
 		}
 	}
 
-	for _, x := range req {
-		rec := models.URLRecord{
-			ShortURL: base62.StdEncoding.EncodeToString([]byte(x.URL)),
-			URL:      x.URL,
+	for i, rec := range recs {
+		rec, err := s.remember(rec)
+		if err != nil {
+			return err
 		}
 
 		*res = append(*res, models.BatchUnitURLResponse{
-			ID:    x.ID,
-			Short: rec.ShortURL,
+			ID:     req[i].ID,
+			Short:  rec.ShortURL,
+			Domain: rec.Domain,
 		})
+	}
+	return nil
+}
+
+// ShortenEach shortens every batch item on its own, reporting whether it was created, already existed,
+// was invalid or blocked instead of failing the whole batch on the first error.
+// With a database all valid items are inserted with bulk statements that also detect existing links.
+func (s *URLs) ShortenEach(ctx context.Context, userID string, req []models.BatchUnitURLRequest) []models.BatchUnitURLResponse {
+	ctx, span := tracing.Tracer().Start(ctx, "URLs.ShortenEach")
+	defer span.End()
+
+	createdAt := time.Now().UTC()
+	res := make([]models.BatchUnitURLResponse, len(req))
+
+	recs := make([]models.URLRecord, 0, len(req))
+	index := make([]int, 0, len(req))
+	for i, x := range req {
+		res[i] = models.BatchUnitURLResponse{ID: x.ID, Domain: x.Domain}
+
+		rec, err := s.newRecord(x.URL, userID, x.Domain, createdAt)
+		if err != nil {
+			res[i].Status, res[i].Error = batchFailure(err)
+			continue
+		}
+		recs = append(recs, rec)
+		index = append(index, i)
+	}
 
-		_, ok := s.Storage.URLs[rec.ShortURL]
-		if !ok {
-			s.MU.Lock()
-			err := s.Encoder.Encode(rec)
+	if s.Storage.DB == nil {
+		for j, rec := range recs {
+			item := &res[index[j]]
+			rec, created, err := s.create(ctx, rec)
 			if err != nil {
-				return err
+				item.Status, item.Error = batchFailure(err)
+				continue
+			}
+			item.Short, item.Status = rec.ShortURL, models.BatchExisting
+			if created {
+				item.Status = models.BatchCreated
 			}
-			s.Storage.URLs[rec.ShortURL] = rec
-			s.MU.Unlock()
 		}
+		return res
 	}
-	return nil
+
+	results, err := s.Storage.InsertBatch(ctx, s.Storage.DB, recs)
+	if err != nil {
+		s.Log.Error("failed to insert batch", "error", err, "size", len(recs))
+		for _, i := range index {
+			res[i].Status, res[i].Error = batchFailure(err)
+		}
+		return res
+	}
+
+	for j, rec := range recs {
+		item := &res[index[j]]
+		if results[j].ShortURL == "" {
+			item.Status, item.Error = batchFailure(ErrorAliasTaken)
+			continue
+		}
+		item.Short, item.Status = results[j].ShortURL, models.BatchExisting
+		if !results[j].Created {
+			continue
+		}
+
+		item.Status = models.BatchCreated
+		if _, err := s.remember(rec); err != nil {
+			s.Log.Error("failed to write batch item to file", "error", err, "url", rec.URL)
+		}
+	}
+	return res
+}
+
+// batchFailure returns the status and message of a batch item that couldn't be shortened
+func batchFailure(err error) (string, string) {
+	switch {
+	case errors.Is(err, ErrorBlocked):
+		return models.BatchBlocked, err.Error()
+	case errors.Is(err, ErrorInvalidURL), errors.Is(err, ErrorAliasTaken):
+		return models.BatchInvalid, err.Error()
+	}
+	return models.BatchFailed, storage.ErrorURLSave.Error()
+}
+
+// remember adds a new record to the file storage and the in-memory map unless it or another link of
+// its canonical URL is already there, and returns the record now stored
+func (s *URLs) remember(rec models.URLRecord) (models.URLRecord, error) {
+	key := storage.Key(rec.Domain, rec.ShortURL)
+
+	s.MU.Lock()
+	defer s.MU.Unlock()
+
+	if short, ok := s.Storage.Canonical(rec.Domain, rec.Canonical); ok {
+		return s.Storage.URLs[storage.Key(rec.Domain, short)], nil
+	}
+	if existing, ok := s.Storage.URLs[key]; ok {
+		return existing, nil
+	}
+	if err := s.Encoder.Encode(rec); err != nil {
+		return rec, err
+	}
+	s.Storage.Index(rec)
+	metrics.LinksCreated.Inc()
+	s.queueMetadata(rec)
+	return rec, nil
 }
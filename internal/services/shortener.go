@@ -7,33 +7,67 @@ import (
 	"sync"
 	"url-shortener/internal/models"
 	"url-shortener/internal/storage"
+	"url-shortener/internal/urlnorm"
 )
 
 // Service defines the interface for URL shortening operations
 type Service interface {
-	SaveURL(ctx context.Context, url, userID string) (string, error)
-	GetURL(ctx context.Context, shortURL string) (string, error)
+	SaveURL(ctx context.Context, url, userID, domain string) (string, error)
+	GetURL(ctx context.Context, domain, shortURL string) (models.URLRecord, error)
+	UpdateURL(ctx context.Context, userID, domain, shortURL string, req models.UpdateURLRequest) (models.URLRecord, error)
 	ShortenBatch(ctx context.Context, userID string, req []models.BatchUnitURLRequest, res *[]models.BatchUnitURLResponse) error
+	ShortenEach(ctx context.Context, userID string, req []models.BatchUnitURLRequest) []models.BatchUnitURLResponse
 	GetUserURLs(ctx context.Context, userID string, res *[]models.UserURLResponse) error
 	PingDB() bool
-	DeleteURLs(ctx context.Context, req []string, userID string) error
+	DeleteURLs(req []string, userID, domain string) error
 	GetStats(ctx context.Context) (models.Stats, error)
+	Country(ip string) string
+	RecordClick(ctx context.Context, click models.Click)
+	GetClickStats(ctx context.Context, userID, domain, shortURL string) (models.ClickStats, error)
+	DefaultDomain(ctx context.Context, userID string) (string, error)
+	SetDefaultDomain(ctx context.Context, userID, domain string) error
+	Block(ctx context.Context, entry string) (int, error)
+	Threat(url string) string
+	ExpandURL(ctx context.Context, url string) (string, error)
+	ImportURL(ctx context.Context, userID string, row models.ImportRow) (models.URLRecord, bool, error)
+	ExportURLs(ctx context.Context, userID string, fn func(models.ExportURL) error) error
 }
 
 // URLs implements the Service interface and manages URL shortening operations
 type URLs struct {
-	MU      sync.RWMutex     // Mutex for thread-safe operations
-	Log     *slog.Logger     // Logger for service operations
-	Storage *storage.Storage // Storage interface for persistence
-	Encoder *json.Encoder    // JSON encoder for data serialization
+	MU        sync.RWMutex                  // Mutex for thread-safe operations
+	Log       *slog.Logger                  // Logger for service operations
+	Storage   *storage.Storage              // Storage interface for persistence
+	Encoder   *json.Encoder                 // JSON encoder for data serialization
+	Geo       Locator                       // Optional GeoIP country lookup
+	Clicks    map[string]*models.ClickStats // In-memory click analytics keyed by short URL, file mode only
+	ClicksMU  sync.RWMutex                  // Guards Clicks apart from MU so redirects don't wait for writers
+	Normalize urlnorm.Options               // Settings of the canonical form used for deduplication
+	Blocklist Blocker                       // Optional blocklist of destination URLs
+	Threats   ThreatChecker                 // Optional hash-prefix threat lists
+	Expander  Expander                      // Optional expander of external shortener links
+	Checker   HealthChecker                 // Optional checker of link destinations
+	Health    map[string]models.Health      // In-memory latest destination checks keyed by short URL
+	Fetcher   MetadataFetcher               // Optional fetcher of destination page metadata
+
+	clickQueue    chan models.Click
+	metadataQueue chan models.URLRecord
 }
 
 // New creates and initializes a new URLs service instance
 func New(ctx context.Context, log *slog.Logger, storage *storage.Storage) *URLs {
 	service := &URLs{
-		Storage: storage,
-		Log:     log,
-		Encoder: json.NewEncoder(&storage.File),
+		Storage:       storage,
+		Log:           log,
+		Encoder:       json.NewEncoder(&storage.File),
+		Clicks:        make(map[string]*models.ClickStats),
+		Health:        make(map[string]models.Health),
+		clickQueue:    make(chan models.Click, 1024),
+		metadataQueue: make(chan models.URLRecord, metadataQueueSize),
+	}
+
+	if storage.DB != nil {
+		go service.processClicks(ctx)
 	}
 	return service
 }
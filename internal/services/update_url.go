@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"url-shortener/internal/models"
+	"url-shortener/internal/redirect"
+	"url-shortener/internal/storage"
+	"url-shortener/internal/tracing"
+)
+
+// UpdateURL applies a partial settings update to a link owned by userID
+func (s *URLs) UpdateURL(ctx context.Context, userID, domain, shortURL string, req models.UpdateURLRequest) (models.URLRecord, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "URLs.UpdateURL")
+	defer span.End()
+
+	rec, err := s.GetURL(ctx, domain, shortURL)
+	if err != nil {
+		return rec, err
+	}
+
+	if rec.UserID != userID {
+		return rec, ErrorForbidden
+	}
+
+	if req.Title != nil {
+		rec.Title = *req.Title
+	}
+
+	if req.Description != nil {
+		rec.Description = *req.Description
+	}
+
+	if req.QueryPolicy != nil {
+		switch *req.QueryPolicy {
+		case "", models.QueryIgnore, models.QueryAppend, models.QueryOverride:
+			rec.QueryPolicy = *req.QueryPolicy
+		default:
+			return rec, ErrorInvalidSettings
+		}
+	}
+
+	if req.UTM != nil {
+		if *req.UTM == (models.UTM{}) {
+			rec.UTM = nil
+		} else {
+			utm := *req.UTM
+			rec.UTM = &utm
+		}
+	}
+
+	if req.Rules != nil {
+		if err := redirect.ValidateRules(*req.Rules); err != nil {
+			return rec, errors.Join(ErrorInvalidSettings, err)
+		}
+		rec.Rules = *req.Rules
+	}
+
+	if req.Variants != nil || req.Winner != nil {
+		variants, winner := rec.Variants, rec.Winner
+		if req.Variants != nil {
+			variants = *req.Variants
+			winner = ""
+		}
+		if req.Winner != nil {
+			winner = *req.Winner
+		}
+
+		if err := redirect.ValidateVariants(variants, winner); err != nil {
+			return rec, errors.Join(ErrorInvalidSettings, err)
+		}
+		rec.Variants, rec.Winner = variants, winner
+	}
+
+	if req.SocialCard != nil {
+		enabled := *req.SocialCard
+		rec.SocialCard = &enabled
+	}
+
+	if req.Card != nil {
+		if err := redirect.ValidateCard(*req.Card); err != nil {
+			return rec, errors.Join(ErrorInvalidSettings, err)
+		}
+		if *req.Card == (models.Card{}) {
+			rec.Card = nil
+		} else {
+			card := *req.Card
+			rec.Card = &card
+		}
+	}
+
+	if (req.Rules != nil || req.Variants != nil) && s.blocked(rec) {
+		return rec, ErrorBlocked
+	}
+
+	return rec, s.store(ctx, rec)
+}
+
+// store persists an updated record to the database and appends it to the file storage
+func (s *URLs) store(ctx context.Context, rec models.URLRecord) error {
+	if s.Storage.DB != nil {
+		if err := s.Storage.Update(ctx, rec); err != nil {
+			return err
+		}
+	}
+
+	s.MU.Lock()
+	defer s.MU.Unlock()
+
+	if err := s.Encoder.Encode(rec); err != nil {
+		return err
+	}
+	s.Storage.URLs[storage.Key(rec.Domain, rec.ShortURL)] = rec
+	return nil
+}
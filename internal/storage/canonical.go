@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"url-shortener/internal/models"
+	"url-shortener/internal/urlnorm"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// canonicalMigration names the one-off backfill of canonical URLs in the migrations table
+const canonicalMigration = "canonical_urls"
+
+// GetCanonical retrieves the link of a canonical URL on a domain, deleted links included
+func (s *Storage) GetCanonical(ctx context.Context, domain, canonical string) (models.URLRecord, error) {
+	row := sq.Select(recordColumns...).
+		From("urls").
+		Where(sq.And{
+			sq.Eq{"domain": domain},
+			sq.Eq{"canonical": canonical},
+		}).
+		PlaceholderFormat(sq.Dollar).
+		RunWith(traced(s.DB)).
+		QueryRowContext(ctx)
+
+	rec, err := scanRecord(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return rec, ErrorNotFound
+	}
+	return rec, err
+}
+
+// Index adds a record to the in-memory maps of the file storage. The first link of a
+// canonical URL on a domain is the one later requests for the same destination get.
+func (s *Storage) Index(rec models.URLRecord) {
+	s.URLs[Key(rec.Domain, rec.ShortURL)] = rec
+	if rec.Canonical == "" {
+		return
+	}
+	key := Key(rec.Domain, rec.Canonical)
+	if _, ok := s.Canonicals[key]; !ok {
+		s.Canonicals[key] = rec.ShortURL
+	}
+}
+
+// Canonical returns the short URL of the link of a canonical URL on a domain in the file storage
+func (s *Storage) Canonical(domain, canonical string) (string, bool) {
+	short, ok := s.Canonicals[Key(domain, canonical)]
+	return short, ok
+}
+
+// backfillCanonical computes the canonical URL of links created before deduplication, which
+// older releases stored as the URL itself. Links keep their short URLs; a link whose canonical
+// URL is already used on its domain keeps its previous value. It runs once per database.
+func backfillCanonical(ctx context.Context, db *sql.DB, opts urlnorm.Options) error {
+	var done bool
+	err := sq.Select("true").
+		From("migrations").
+		Where(sq.Eq{"name": canonicalMigration}).
+		PlaceholderFormat(sq.Dollar).
+		RunWith(db).
+		QueryRowContext(ctx).
+		Scan(&done)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	rows, err := sq.Select("domain", "short_url", "url").
+		From("urls").
+		Where(sq.Or{sq.Eq{"canonical": nil}, sq.Expr("canonical = url")}).
+		OrderBy("created_at NULLS FIRST").
+		PlaceholderFormat(sq.Dollar).
+		RunWith(db).
+		QueryContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	var legacy []models.URLRecord
+	for rows.Next() {
+		var rec models.URLRecord
+		if err := rows.Scan(&rec.Domain, &rec.ShortURL, &rec.URL); err != nil {
+			rows.Close()
+			return err
+		}
+		legacy = append(legacy, rec)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, rec := range legacy {
+		canonical, err := urlnorm.Normalize(rec.URL, opts)
+		if err != nil {
+			continue
+		}
+
+		_, err = sq.Update("urls").
+			Set("canonical", canonical).
+			Where(sq.And{
+				sq.Eq{"domain": rec.Domain},
+				sq.Eq{"short_url": rec.ShortURL},
+				sq.Expr("NOT EXISTS (SELECT 1 FROM urls o WHERE o.domain = urls.domain AND o.canonical = ?)", canonical),
+			}).
+			PlaceholderFormat(sq.Dollar).
+			RunWith(db).
+			ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = sq.Insert("migrations").
+		Columns("name").
+		Values(canonicalMigration).
+		PlaceholderFormat(sq.Dollar).
+		RunWith(db).
+		ExecContext(ctx)
+	return err
+}
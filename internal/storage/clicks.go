@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"url-shortener/internal/models"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// SaveClicks stores a batch of recorded redirects
+func (s *Storage) SaveClicks(ctx context.Context, runner sq.BaseRunner, clicks []models.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	query := sq.Insert("clicks").
+		Columns("domain", "short_url", "clicked_at", "country", "variant")
+	for _, x := range clicks {
+		query = query.Values(x.Domain, x.ShortURL, x.Time, x.Country, x.Variant)
+	}
+
+	_, err := query.
+		RunWith(traced(runner)).
+		PlaceholderFormat(sq.Dollar).
+		ExecContext(ctx)
+	return err
+}
+
+// ClickStats aggregates the recorded redirects of a short URL on a domain by country and variant
+func (s *Storage) ClickStats(ctx context.Context, domain, shortURL string) (models.ClickStats, error) {
+	res := models.ClickStats{Countries: map[string]int{}, Variants: map[string]int{}}
+
+	rows, err := sq.Select("country", "variant", "COUNT(*)").
+		From("clicks").
+		Where(sq.And{
+			sq.Eq{"domain": domain},
+			sq.Eq{"short_url": shortURL},
+		}).
+		GroupBy("country", "variant").
+		PlaceholderFormat(sq.Dollar).
+		RunWith(traced(s.DB)).
+		QueryContext(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var country, variant string
+		var count int
+		if err := rows.Scan(&country, &variant, &count); err != nil {
+			return res, err
+		}
+		res.Clicks += count
+		if country != "" {
+			res.Countries[country] += count
+		}
+		if variant != "" {
+			res.Variants[variant] += count
+		}
+	}
+
+	return res, rows.Err()
+}
@@ -7,17 +7,18 @@ import (
 	sq "github.com/Masterminds/squirrel"
 )
 
-// Delete marks multiple URLs as deleted in the database for a given user
+// Delete marks multiple URLs as deleted in the database for a given user, each on its own domain
 func (s *Storage) Delete(ctx context.Context, runner sq.BaseRunner, records []models.DeleteRecord) error {
 	for _, x := range records {
 		_, err := sq.Update("urls").
 			Set("deleted", true).
 			Where(sq.And{
 				sq.Eq{"user_id": x.UserID},
+				sq.Eq{"domain": x.Domain},
 				sq.Eq{"short_url": x.ShortURL},
 			}).
 			PlaceholderFormat(sq.Dollar).
-			RunWith(runner).
+			RunWith(traced(runner)).
 			ExecContext(ctx)
 
 		if err != nil {
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"url-shortener/internal/models"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// activePage is the number of links read per query by EachActive
+const activePage = 500
+
+// EachActive passes the links that are neither deleted nor disabled to fn a page at a time,
+// so that scanning every link never holds the whole table in memory
+func (s *Storage) EachActive(ctx context.Context, fn func([]models.URLRecord) error) error {
+	var domain, shortURL string
+	for {
+		rows, err := sq.Select(recordColumns...).
+			From("urls").
+			Where(sq.And{
+				sq.Eq{"deleted": false},
+				sq.Or{sq.Eq{"disabled": false}, sq.Eq{"disabled": nil}},
+				sq.Expr("(domain, short_url) > (?, ?)", domain, shortURL),
+			}).
+			OrderBy("domain", "short_url").
+			Limit(activePage).
+			PlaceholderFormat(sq.Dollar).
+			RunWith(traced(s.DB)).
+			QueryContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		page := make([]models.URLRecord, 0, activePage)
+		for rows.Next() {
+			rec, err := scanRecord(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			page = append(page, rec)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(page) == 0 {
+			return nil
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		if len(page) < activePage {
+			return nil
+		}
+		last := page[len(page)-1]
+		domain, shortURL = last.Domain, last.ShortURL
+	}
+}
+
+// Disable marks links as disabled so that they are no longer redirected
+func (s *Storage) Disable(ctx context.Context, runner sq.BaseRunner, recs []models.URLRecord) error {
+	for _, x := range recs {
+		_, err := sq.Update("urls").
+			Set("disabled", true).
+			Where(sq.And{
+				sq.Eq{"domain": x.Domain},
+				sq.Eq{"short_url": x.ShortURL},
+			}).
+			PlaceholderFormat(sq.Dollar).
+			RunWith(traced(runner)).
+			ExecContext(ctx)
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
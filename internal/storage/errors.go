@@ -7,6 +7,7 @@ import (
 // Package level errors for the URL shortener service layer
 var (
 	ErrorDuplicate  = errors.New("duplicate URL record")
+	ErrorShortTaken = errors.New("short URL is already taken")
 	ErrorNotFound   = errors.New("error finding URL")
 	ErrorURLDeleted = errors.New("URL was deleted")
 	ErrorURLSave    = errors.New("can't save URL")
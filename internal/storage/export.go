@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"url-shortener/internal/models"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// clicksColumn counts the recorded redirects of each selected urls row
+const clicksColumn = "(SELECT COUNT(*) FROM clicks WHERE clicks.domain = urls.domain AND clicks.short_url = urls.short_url)"
+
+// Export streams every URL record of a user, deleted ones included, with its click count to fn in creation order.
+// Rows are read one at a time so that large accounts aren't loaded into memory.
+func (s *Storage) Export(ctx context.Context, userID string, fn func(rec models.URLRecord, clicks int) error) error {
+	rows, err := sq.Select(slices.Concat(recordColumns, []string{clicksColumn})...).
+		From("urls").
+		Where(sq.Eq{"user_id": userID}).
+		OrderBy("created_at", "domain", "short_url").
+		PlaceholderFormat(sq.Dollar).
+		RunWith(traced(s.DB)).
+		QueryContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var clicks int
+		rec, err := scanRecord(rows, &clicks)
+		if err != nil {
+			return err
+		}
+		if err := fn(rec, clicks); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
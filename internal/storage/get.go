@@ -2,33 +2,39 @@ package storage
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"url-shortener/internal/models"
 
 	sq "github.com/Masterminds/squirrel"
 )
 
-// Get retrieves the original URL using the shortened URL
-func (s *Storage) Get(ctx context.Context, shortURL string) (string, error) {
-	var url models.URLRecord
-
-	row := sq.Select("url", "deleted").
+// Get retrieves the URL record using the shortened URL on a domain
+func (s *Storage) Get(ctx context.Context, domain, shortURL string) (models.URLRecord, error) {
+	row := sq.Select(recordColumns...).
 		From("urls").
-		Where(sq.Eq{"short_url": shortURL}).
+		Where(sq.And{
+			sq.Eq{"domain": domain},
+			sq.Eq{"short_url": shortURL},
+		}).
 		PlaceholderFormat(sq.Dollar).
-		RunWith(s.DB).
+		RunWith(traced(s.DB)).
 		QueryRowContext(ctx)
 
-	err := row.Scan(&url.URL, &url.Deleted)
+	rec, err := scanRecord(row)
 	if err != nil {
-		return "", err
+		if errors.Is(err, sql.ErrNoRows) {
+			return rec, ErrorNotFound
+		}
+		return rec, err
 	}
 
-	if url.Deleted {
-		return "", ErrorURLDeleted
+	if rec.Deleted {
+		return rec, ErrorURLDeleted
 	}
 
-	if url.URL != "" {
-		return url.URL, nil
+	if rec.URL != "" {
+		return rec, nil
 	}
-	return "", ErrorNotFound
+	return rec, ErrorNotFound
 }
@@ -9,11 +9,11 @@ import (
 
 // GetMultiple retrieves all shortened URLs for a user
 func (s *Storage) GetMultiple(ctx context.Context, userID string, res *[]models.UserURLResponse) error {
-	rows, err := sq.Select("short_url", "url").
+	rows, err := sq.Select(recordColumns...).
 		From("urls").
 		Where(sq.Eq{"user_id": userID}).
 		PlaceholderFormat(sq.Dollar).
-		RunWith(s.DB).
+		RunWith(traced(s.DB)).
 		QueryContext(ctx)
 
 	if err != nil {
@@ -22,12 +22,11 @@ func (s *Storage) GetMultiple(ctx context.Context, userID string, res *[]models.
 	defer rows.Close()
 
 	for rows.Next() {
-		var url models.UserURLResponse
-		err := rows.Scan(&url.ShortURL, &url.OriginalURL)
+		rec, err := scanRecord(rows)
 		if err != nil {
 			return err
 		}
-		*res = append(*res, url)
+		*res = append(*res, rec.UserURL())
 	}
 
 	if err = rows.Err(); err != nil {
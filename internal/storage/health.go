@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"context"
+	"url-shortener/internal/models"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// SetHealth stores the latest destination check of a link
+func (s *Storage) SetHealth(ctx context.Context, domain, shortURL string, health models.Health) error {
+	h, err := marshalJSON(health)
+	if err != nil {
+		return err
+	}
+
+	_, err = sq.Update("urls").
+		Set("health", h).
+		Where(sq.And{
+			sq.Eq{"domain": domain},
+			sq.Eq{"short_url": shortURL},
+		}).
+		PlaceholderFormat(sq.Dollar).
+		RunWith(traced(s.DB)).
+		ExecContext(ctx)
+	return err
+}
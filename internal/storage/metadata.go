@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"context"
+	"url-shortener/internal/models"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// SetMetadata stores the metadata fetched from a link's destination page
+func (s *Storage) SetMetadata(ctx context.Context, domain, shortURL string, meta models.Metadata) error {
+	m, err := marshalJSON(meta)
+	if err != nil {
+		return err
+	}
+
+	_, err = sq.Update("urls").
+		Set("metadata", m).
+		Where(sq.And{
+			sq.Eq{"domain": domain},
+			sq.Eq{"short_url": shortURL},
+		}).
+		PlaceholderFormat(sq.Dollar).
+		RunWith(traced(s.DB)).
+		ExecContext(ctx)
+	return err
+}
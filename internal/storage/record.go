@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"url-shortener/internal/models"
+)
+
+// recordColumns lists the urls table columns scanned into a URLRecord
+var recordColumns = []string{"user_id", "short_url", "url", "deleted", "disabled", "canonical", "domain", "title", "description", "created_at", "query_policy", "utm", "rules", "variants", "winner", "social_card", "card", "tags", "expires_at", "health", "metadata"}
+
+// rowScanner is implemented by both sql.Row and sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanRecord reads a single urls row selected with recordColumns, followed by any extra columns
+func scanRecord(row rowScanner, extra ...any) (models.URLRecord, error) {
+	var rec models.URLRecord
+	var userID, canonical, title, description, policy, winner sql.NullString
+	var disabled, socialCard sql.NullBool
+	var createdAt, expiresAt sql.NullTime
+	var utm, rules, variants, card, tags, health, metadata []byte
+
+	dest := []any{&userID, &rec.ShortURL, &rec.URL, &rec.Deleted, &disabled, &canonical, &rec.Domain, &title, &description, &createdAt,
+		&policy, &utm, &rules, &variants, &winner, &socialCard, &card, &tags, &expiresAt, &health, &metadata}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return rec, err
+	}
+
+	rec.UserID = userID.String
+	rec.Disabled = disabled.Bool
+	rec.Canonical = canonical.String
+	rec.Title = title.String
+	rec.Description = description.String
+	rec.CreatedAt = createdAt.Time
+	rec.QueryPolicy = policy.String
+	rec.Winner = winner.String
+	if expiresAt.Valid {
+		rec.ExpiresAt = &expiresAt.Time
+	}
+	if socialCard.Valid {
+		rec.SocialCard = &socialCard.Bool
+	}
+	if len(utm) > 0 {
+		if err := json.Unmarshal(utm, &rec.UTM); err != nil {
+			return rec, err
+		}
+	}
+	if len(rules) > 0 {
+		if err := json.Unmarshal(rules, &rec.Rules); err != nil {
+			return rec, err
+		}
+	}
+	if len(variants) > 0 {
+		if err := json.Unmarshal(variants, &rec.Variants); err != nil {
+			return rec, err
+		}
+	}
+	if len(card) > 0 {
+		if err := json.Unmarshal(card, &rec.Card); err != nil {
+			return rec, err
+		}
+	}
+	if len(tags) > 0 {
+		if err := json.Unmarshal(tags, &rec.Tags); err != nil {
+			return rec, err
+		}
+	}
+	if len(health) > 0 {
+		if err := json.Unmarshal(health, &rec.Health); err != nil {
+			return rec, err
+		}
+	}
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &rec.Metadata); err != nil {
+			return rec, err
+		}
+	}
+	return rec, nil
+}
+
+// marshalJSON encodes v for a jsonb column, storing NULL for empty values
+func marshalJSON(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if string(b) == "null" {
+		return nil, nil
+	}
+	return string(b), nil
+}
@@ -12,16 +12,24 @@ import (
 
 // Save stores a URL with its shortened version and user ID
 func (s *Storage) Save(ctx context.Context, rec models.URLRecord) error {
-	_, err := sq.Insert("urls").
-		Columns("user_id", "short_url", "url").
-		Values(rec.UserID, rec.ShortURL, rec.URL).
-		RunWith(s.DB).
+	tags, err := marshalJSON(rec.Tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = sq.Insert("urls").
+		Columns("user_id", "short_url", "url", "canonical", "domain", "created_at", "tags", "expires_at").
+		Values(rec.UserID, rec.ShortURL, rec.URL, rec.Canonical, rec.Domain, rec.CreatedAt, tags, rec.ExpiresAt).
+		RunWith(traced(s.DB)).
 		PlaceholderFormat(sq.Dollar).
 		ExecContext(ctx)
 
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			if pgErr.ConstraintName == ShortURLIndex {
+				return ErrorShortTaken
+			}
 			return ErrorDuplicate
 		}
 		return ErrorURLSave
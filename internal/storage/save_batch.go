@@ -4,27 +4,139 @@ import (
 	"context"
 	"url-shortener/internal/models"
 
-	"github.com/deatil/go-encoding/base62"
-
 	sq "github.com/Masterminds/squirrel"
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
-// SaveBatch stores multiple URLs with their shortened version and user ID
-func (s *Storage) SaveBatch(ctx context.Context, runner sq.BaseRunner, userID string, req []models.BatchUnitURLRequest) error {
-	for _, x := range req {
-		short := base62.StdEncoding.EncodeToString([]byte(x.URL))
+// batchChunk bounds the rows of a single multi-row INSERT, keeping it well under the 65535 parameters Postgres allows
+const batchChunk = 1000
 
-		_, err := sq.Insert("urls").
-			Columns("user_id", "short_url", "url").
-			Values(userID, short, x.URL).
-			RunWith(runner).
-			PlaceholderFormat(sq.Dollar).
-			ExecContext(ctx)
+// BatchResult tells what InsertBatch did with a record
+type BatchResult struct {
+	// ShortURL is the short URL stored for the record's canonical URL on its domain. It is empty when
+	// the record was not inserted because its short URL belongs to a link of another destination.
+	ShortURL string
+	// Created reports whether the record itself was inserted
+	Created bool
+}
+
+// SaveBatch stores multiple URL records with their shortened version and user ID, failing with
+// ErrorDuplicate if any of them already has a link or ErrorShortTaken if any short URL is used by another destination
+func (s *Storage) SaveBatch(ctx context.Context, runner sq.BaseRunner, recs []models.URLRecord) error {
+	results, err := s.InsertBatch(ctx, runner, recs)
+	if err != nil {
+		return err
+	}
+	for _, res := range results {
+		switch {
+		case res.ShortURL == "":
+			return ErrorShortTaken
+		case !res.Created:
+			return ErrorDuplicate
+		}
+	}
+	return nil
+}
 
+// InsertBatch stores URL records with multi-row INSERT ... ON CONFLICT DO NOTHING statements of up to batchChunk rows
+// and reports for each record whether it was inserted and which short URL its canonical URL has. The short URLs of
+// records that were not inserted, which may be aliases, legacy or deleted links, are looked up with a single SELECT
+// per chunk on the same runner, so a batch without conflicts takes one round trip per chunk and one with conflicts two.
+// Of several records with the same canonical URL on a domain only the first is inserted.
+func (s *Storage) InsertBatch(ctx context.Context, runner sq.BaseRunner, recs []models.URLRecord) ([]BatchResult, error) {
+	results := make([]BatchResult, len(recs))
+
+	for start := 0; start < len(recs); start += batchChunk {
+		chunk := recs[start:min(start+batchChunk, len(recs))]
+
+		query := sq.Insert("urls").
+			Columns("user_id", "short_url", "url", "canonical", "domain", "created_at", "tags", "expires_at")
+		pending := make(map[string][]int, len(chunk))
+		for i, x := range chunk {
+			tags, err := marshalJSON(x.Tags)
+			if err != nil {
+				return nil, err
+			}
+			query = query.Values(x.UserID, x.ShortURL, x.URL, x.Canonical, x.Domain, x.CreatedAt, tags, x.ExpiresAt)
+
+			key := Key(x.Domain, x.ShortURL)
+			pending[key] = append(pending[key], start+i)
+		}
+
+		rows, err := query.
+			Suffix("ON CONFLICT DO NOTHING RETURNING domain, short_url").
+			PlaceholderFormat(sq.Dollar).
+			RunWith(traced(runner)).
+			QueryContext(ctx)
 		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var domain, shortURL string
+			if err := rows.Scan(&domain, &shortURL); err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			key := Key(domain, shortURL)
+			if idx := pending[key]; len(idx) > 0 {
+				results[idx[0]] = BatchResult{ShortURL: shortURL, Created: true}
+				pending[key] = idx[1:]
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		if err := s.existingShorts(ctx, runner, recs, results, start, len(chunk)); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// existingShorts fills in the short URLs stored for the canonical URLs of the records of a chunk that were not inserted
+func (s *Storage) existingShorts(ctx context.Context, runner sq.BaseRunner, recs []models.URLRecord, results []BatchResult, start, n int) error {
+	var missing []int
+	var where sq.Or
+	for i := start; i < start+n; i++ {
+		if results[i].Created {
+			continue
+		}
+		missing = append(missing, i)
+		where = append(where, sq.Eq{"domain": recs[i].Domain, "canonical": recs[i].Canonical})
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	rows, err := sq.Select("domain", "canonical", "short_url").
+		From("urls").
+		Where(where).
+		PlaceholderFormat(sq.Dollar).
+		RunWith(traced(runner)).
+		QueryContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	shorts := make(map[string]string, len(missing))
+	for rows.Next() {
+		var domain, canonical, shortURL string
+		if err := rows.Scan(&domain, &canonical, &shortURL); err != nil {
 			return err
 		}
+		shorts[Key(domain, canonical)] = shortURL
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, i := range missing {
+		results[i].ShortURL = shorts[Key(recs[i].Domain, recs[i].Canonical)]
 	}
 	return nil
 }
@@ -15,7 +15,7 @@ func (s *Storage) Stats(ctx context.Context) (models.Stats, error) {
 	urlRow := sq.Select("COUNT(DISTINCT url)").
 		From("urls").
 		PlaceholderFormat(sq.Dollar).
-		RunWith(s.DB).
+		RunWith(traced(s.DB)).
 		QueryRowContext(ctx)
 
 	err := urlRow.Scan(&urls)
@@ -27,7 +27,7 @@ func (s *Storage) Stats(ctx context.Context) (models.Stats, error) {
 	userRow := sq.Select("COUNT(DISTINCT user_id)").
 		From("urls").
 		PlaceholderFormat(sq.Dollar).
-		RunWith(s.DB).
+		RunWith(traced(s.DB)).
 		QueryRowContext(ctx)
 
 	err = userRow.Scan(&users)
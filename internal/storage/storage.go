@@ -8,6 +8,7 @@ import (
 	"os"
 	"url-shortener/internal/config"
 	"url-shortener/internal/models"
+	"url-shortener/internal/urlnorm"
 )
 
 // Storage holds the file, database and URL mapping information
@@ -16,6 +17,16 @@ type Storage struct {
 	DB   *sql.DB
 	File os.File
 	URLs map[string]models.URLRecord
+	// Canonicals maps canonical URLs on a domain to their short URLs in the file storage
+	Canonicals map[string]string
+	// Domains maps user IDs to their default short domains in the file storage
+	Domains map[string]string
+}
+
+// fileLine is a line of the file storage, either a URL record or a settings record
+type fileLine struct {
+	models.URLRecord
+	models.SettingsRecord
 }
 
 // Query for creating urls table
@@ -23,6 +34,49 @@ var (
 	UrlsQuery = `CREATE TABLE IF NOT EXISTS urls (user_id text, short_url text, url text PRIMARY KEY, deleted bool DEFAULT false);`
 )
 
+// ShortURLIndex is the unique index keeping short URLs unique per domain
+const ShortURLIndex = "urls_domain_short_url_key"
+
+// MigrationQueries add columns introduced after the initial urls table
+var MigrationQueries = []string{
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS query_policy text DEFAULT '';`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS utm jsonb;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS title text DEFAULT '';`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS description text DEFAULT '';`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS created_at timestamptz;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS rules jsonb;`,
+	`CREATE TABLE IF NOT EXISTS clicks (short_url text NOT NULL, clicked_at timestamptz NOT NULL, country text DEFAULT '');`,
+	`CREATE INDEX IF NOT EXISTS clicks_short_url_idx ON clicks (short_url);`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS variants jsonb;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS winner text DEFAULT '';`,
+	`ALTER TABLE clicks ADD COLUMN IF NOT EXISTS variant text DEFAULT '';`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS domain text NOT NULL DEFAULT '';`,
+	`ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_pkey;`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS urls_domain_url_idx ON urls (domain, url);`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS urls_domain_short_url_key ON urls (domain, short_url);`,
+	`DROP INDEX IF EXISTS urls_domain_short_url_idx;`,
+	`ALTER TABLE clicks ADD COLUMN IF NOT EXISTS domain text DEFAULT '';`,
+	`CREATE TABLE IF NOT EXISTS user_settings (user_id text PRIMARY KEY, default_domain text DEFAULT '');`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS canonical text;`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS urls_domain_canonical_idx ON urls (domain, canonical);`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS disabled bool DEFAULT false;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS health jsonb;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS metadata jsonb;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS social_card bool;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS card jsonb;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS tags jsonb;`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS expires_at timestamptz;`,
+	`CREATE TABLE IF NOT EXISTS migrations (name text PRIMARY KEY);`,
+}
+
+// Key returns the in-memory key of a short URL on a domain, "" being the default domain
+func Key(domain, shortURL string) string {
+	if domain == "" {
+		return shortURL
+	}
+	return domain + "/" + shortURL
+}
+
 // New creates a new Storage instance with file and database connections
 func New(ctx context.Context, cfg *config.Config) (*Storage, error) {
 	file, err := os.OpenFile(cfg.StoragePath, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
@@ -30,24 +84,40 @@ func New(ctx context.Context, cfg *config.Config) (*Storage, error) {
 		return nil, err
 	}
 
-	urls := make(map[string]models.URLRecord)
+	opts := urlnorm.Options{StripTracking: cfg.StripTracking}
 	records := []models.URLRecord{}
+	domains := make(map[string]string)
 
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		var record models.URLRecord
-		err := json.Unmarshal(scanner.Bytes(), &record)
+		var line fileLine
+		err := json.Unmarshal(scanner.Bytes(), &line)
 		if err != nil {
 			return nil, err
 		}
-		records = append(records, record)
+		// settings lines are replayed in order, the last one of a user wins
+		if line.Settings != nil {
+			domains[line.Settings.UserID] = line.Settings.DefaultDomain
+			continue
+		}
+		records = append(records, line.URLRecord)
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
 
+	storage := Storage{
+		cfg:        cfg,
+		URLs:       make(map[string]models.URLRecord),
+		Canonicals: make(map[string]string),
+		Domains:    domains,
+	}
 	for _, record := range records {
-		urls[record.URL] = record
+		// records written before deduplication have no canonical URL
+		if record.Canonical == "" {
+			record.Canonical, _ = urlnorm.Normalize(record.URL, opts)
+		}
+		storage.Index(record)
 	}
 
 	var db *sql.DB
@@ -61,14 +131,19 @@ func New(ctx context.Context, cfg *config.Config) (*Storage, error) {
 		if err != nil {
 			return nil, err
 		}
-	}
 
-	storage := Storage{
-		cfg:  cfg,
-		File: *file,
-		URLs: urls,
-		DB:   db,
+		for _, query := range MigrationQueries {
+			if _, err = db.Exec(query); err != nil {
+				return nil, err
+			}
+		}
+
+		if err = backfillCanonical(ctx, db, opts); err != nil {
+			return nil, err
+		}
 	}
 
+	storage.File = *file
+	storage.DB = db
 	return &storage, err
 }
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"url-shortener/internal/tracing"
+
+	sq "github.com/Masterminds/squirrel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedRunner starts a span for every statement squirrel runs with a context
+type tracedRunner struct {
+	sq.StdSqlCtx
+}
+
+// traced wraps the runner so its queries are traced, runners without context support are returned as is
+func traced(runner sq.BaseRunner) sq.BaseRunner {
+	if r, ok := runner.(sq.StdSqlCtx); ok {
+		return tracedRunner{r}
+	}
+	return runner
+}
+
+// QueryContext traces the query until its rows are ready to be read
+func (r tracedRunner) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := startQuery(ctx, query)
+	rows, err := r.StdSqlCtx.QueryContext(ctx, query, args...)
+	tracing.End(span, err)
+	return rows, err
+}
+
+// QueryRowContext traces the query returning a single row
+func (r tracedRunner) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := startQuery(ctx, query)
+	row := r.StdSqlCtx.QueryRowContext(ctx, query, args...)
+	tracing.End(span, row.Err())
+	return row
+}
+
+// ExecContext traces the statement and the number of rows it affected
+func (r tracedRunner) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := startQuery(ctx, query)
+	res, err := r.StdSqlCtx.ExecContext(ctx, query, args...)
+	if err == nil {
+		if n, err := res.RowsAffected(); err == nil {
+			span.SetAttributes(attribute.Int64("db.rows_affected", n))
+		}
+	}
+	tracing.End(span, err)
+	return res, err
+}
+
+// startQuery starts a client span named after the SQL operation and table of the query
+func startQuery(ctx context.Context, query string) (context.Context, trace.Span) {
+	op, table := describe(query)
+	return tracing.Tracer().Start(ctx, strings.TrimSpace(op+" "+table),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", op),
+			attribute.String("db.sql.table", table),
+			attribute.String("db.statement", query),
+		),
+	)
+}
+
+// describe returns the operation of the query and the first table it reads or writes
+func describe(query string) (op, table string) {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return "", ""
+	}
+	op = strings.ToUpper(words[0])
+	for i, w := range words[:len(words)-1] {
+		switch strings.ToUpper(w) {
+		case "FROM", "INTO", "UPDATE":
+			return op, words[i+1]
+		}
+	}
+	return op, ""
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"url-shortener/internal/models"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Update stores the editable settings of an existing URL record
+func (s *Storage) Update(ctx context.Context, rec models.URLRecord) error {
+	utm, err := marshalJSON(rec.UTM)
+	if err != nil {
+		return err
+	}
+
+	rules, err := marshalJSON(rec.Rules)
+	if err != nil {
+		return err
+	}
+
+	variants, err := marshalJSON(rec.Variants)
+	if err != nil {
+		return err
+	}
+
+	card, err := marshalJSON(rec.Card)
+	if err != nil {
+		return err
+	}
+
+	res, err := sq.Update("urls").
+		Set("title", rec.Title).
+		Set("description", rec.Description).
+		Set("query_policy", rec.QueryPolicy).
+		Set("utm", utm).
+		Set("rules", rules).
+		Set("variants", variants).
+		Set("winner", rec.Winner).
+		Set("social_card", rec.SocialCard).
+		Set("card", card).
+		Where(sq.And{
+			sq.Eq{"user_id": rec.UserID},
+			sq.Eq{"domain": rec.Domain},
+			sq.Eq{"short_url": rec.ShortURL},
+		}).
+		PlaceholderFormat(sq.Dollar).
+		RunWith(traced(s.DB)).
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
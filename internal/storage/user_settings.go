@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// SetUserDomain stores the default short domain of a user
+func (s *Storage) SetUserDomain(ctx context.Context, userID, domain string) error {
+	_, err := sq.Insert("user_settings").
+		Columns("user_id", "default_domain").
+		Values(userID, domain).
+		Suffix("ON CONFLICT (user_id) DO UPDATE SET default_domain = EXCLUDED.default_domain").
+		RunWith(traced(s.DB)).
+		PlaceholderFormat(sq.Dollar).
+		ExecContext(ctx)
+	return err
+}
+
+// UserDomain returns the default short domain of a user, "" if none was chosen
+func (s *Storage) UserDomain(ctx context.Context, userID string) (string, error) {
+	var domain sql.NullString
+
+	err := sq.Select("default_domain").
+		From("user_settings").
+		Where(sq.Eq{"user_id": userID}).
+		PlaceholderFormat(sq.Dollar).
+		RunWith(traced(s.DB)).
+		QueryRowContext(ctx).
+		Scan(&domain)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return domain.String, err
+}
@@ -0,0 +1,174 @@
+package threatlist
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// hashes returns the SHA256 of every host suffix/path prefix expression of a URL
+func hashes(rawURL string) [][sha256.Size]byte {
+	var res [][sha256.Size]byte
+	for _, expr := range expressions(rawURL) {
+		res = append(res, sha256.Sum256([]byte(expr)))
+	}
+	return res
+}
+
+// expressions builds the host suffix/path prefix combinations looked up for a URL
+func expressions(rawURL string) []string {
+	host, path, query := canonicalize(rawURL)
+	if host == "" {
+		return nil
+	}
+
+	hosts := []string{host}
+	if net.ParseIP(host) == nil {
+		parts := strings.Split(host, ".")
+		for i := max(1, len(parts)-5); i < len(parts)-1; i++ {
+			hosts = append(hosts, strings.Join(parts[i:], "."))
+		}
+	}
+
+	var paths []string
+	if query != "" {
+		paths = append(paths, path+"?"+query)
+	}
+	paths = append(paths, path)
+	prefix := "/"
+	for _, part := range strings.SplitAfter(strings.TrimPrefix(path, "/"), "/") {
+		if len(paths) >= 6 {
+			break
+		}
+		if prefix != path {
+			paths = append(paths, prefix)
+		}
+		if !strings.HasSuffix(part, "/") {
+			break
+		}
+		prefix += part
+	}
+
+	seen := make(map[string]bool)
+	var res []string
+	for _, h := range hosts {
+		for _, p := range paths {
+			if expr := h + p; !seen[expr] {
+				seen[expr] = true
+				res = append(res, expr)
+			}
+		}
+	}
+	return res
+}
+
+// canonicalize brings a URL to the Safe Browsing canonical form, split into host, path and query
+func canonicalize(rawURL string) (string, string, string) {
+	u := strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(rawURL))
+
+	u, _, _ = strings.Cut(u, "#")
+	for {
+		unescaped := unescape(u)
+		if unescaped == u {
+			break
+		}
+		u = unescaped
+	}
+
+	if _, rest, ok := strings.Cut(u, "://"); ok {
+		u = rest
+	}
+
+	end := strings.IndexAny(u, "/?")
+	if end < 0 {
+		end = len(u)
+	}
+	host, rest := u[:end], u[end:]
+	path, query, _ := strings.Cut(rest, "?")
+
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		host = host[i+1:]
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.Trim(host, "."))
+	for strings.Contains(host, "..") {
+		host = strings.ReplaceAll(host, "..", ".")
+	}
+
+	return escape(host), escape(cleanPath(path)), escape(query)
+}
+
+// cleanPath resolves "." and ".." segments and collapses consecutive slashes
+func cleanPath(path string) string {
+	var parts []string
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		switch s {
+		case "", ".":
+			if i == len(segments)-1 && len(parts) > 0 {
+				parts = append(parts, "")
+			}
+		case "..":
+			if len(parts) > 0 {
+				parts = parts[:len(parts)-1]
+			}
+			if i == len(segments)-1 {
+				parts = append(parts, "")
+			}
+		default:
+			parts = append(parts, s)
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// unescape decodes valid percent escapes, leaving invalid ones untouched
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// escape percent-encodes control characters, non-ASCII bytes, '#' and '%'
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= 0x20 || c >= 0x7f || c == '#' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,72 @@
+package threatlist
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Source provides list updates for the stored list states
+type Source interface {
+	Fetch(ctx context.Context, lists []ListRequest) (io.ReadCloser, error)
+}
+
+// FileSource reads updates from a file on disk
+type FileSource struct {
+	Path string
+}
+
+// Fetch opens the update file, the stored states are not needed
+func (f FileSource) Fetch(ctx context.Context, lists []ListRequest) (io.ReadCloser, error) {
+	return os.Open(f.Path)
+}
+
+// HTTPSource requests updates from a threatListUpdates:fetch compatible URL
+type HTTPSource struct {
+	URL    string
+	Client *http.Client // http.DefaultClient if nil
+}
+
+// Fetch posts the stored list states and returns the update body
+func (h HTTPSource) Fetch(ctx context.Context, lists []ListRequest) (io.ReadCloser, error) {
+	body, err := json.Marshal(struct {
+		ListUpdateRequests []ListRequest `json:"listUpdateRequests"`
+	}{lists})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("threat list update: unexpected status %s", res.Status)
+	}
+	return res.Body, nil
+}
+
+// NewSource returns an HTTPSource for http(s) URLs and a FileSource for anything else
+func NewSource(location string) Source {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return HTTPSource{URL: location}
+	}
+	return FileSource{Path: location}
+}
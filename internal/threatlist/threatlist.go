@@ -0,0 +1,322 @@
+// Package threatlist checks URLs against locally stored hash-prefix threat lists
+// in the Safe Browsing v4 update format.
+//
+// Lists are kept on disk as a snapshot in the same JSON format as updates, so a stored
+// database is loaded by applying it as a full update. Updates are fetched from a Source,
+// applied with their removals and additions and verified against their checksum.
+// Only RAW compressed entries are supported. A match of a hash prefix is reported as a
+// threat without confirming the full hash.
+package threatlist
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Errors returned while applying updates
+var (
+	ErrorChecksum    = errors.New("threat list checksum mismatch")
+	ErrorUnsupported = errors.New("unsupported threat list encoding")
+	ErrorIndex       = errors.New("threat list removal index out of range")
+	ErrorDescriptor  = errors.New("threat list must look like THREAT_TYPE/PLATFORM_TYPE/THREAT_ENTRY_TYPE")
+)
+
+// DefaultLists are the lists fetched when none are configured
+var DefaultLists = []string{
+	"MALWARE/ANY_PLATFORM/URL",
+	"SOCIAL_ENGINEERING/ANY_PLATFORM/URL",
+	"UNWANTED_SOFTWARE/ANY_PLATFORM/URL",
+}
+
+// List is a set of threat lists, optionally backed by a snapshot file
+type List struct {
+	mu      sync.RWMutex
+	path    string
+	lists   map[string]*threatList
+	tracked []ListRequest
+}
+
+// threatList holds the sorted hash prefixes of a single threat type, platform and entry type
+type threatList struct {
+	ThreatType      string
+	PlatformType    string
+	ThreatEntryType string
+	State           string
+	prefixes        []string
+	sizes           []int
+}
+
+// key identifies a list by its descriptor
+func (l *threatList) key() string {
+	return l.ThreatType + "/" + l.PlatformType + "/" + l.ThreatEntryType
+}
+
+// ParseLists reads list descriptors written as THREAT_TYPE/PLATFORM_TYPE/THREAT_ENTRY_TYPE
+func ParseLists(descriptors []string) ([]ListRequest, error) {
+	res := make([]ListRequest, 0, len(descriptors))
+	for _, d := range descriptors {
+		parts := strings.Split(strings.TrimSpace(d), "/")
+		if len(parts) != 3 || slices.Contains(parts, "") {
+			return nil, fmt.Errorf("%w: %q", ErrorDescriptor, d)
+		}
+		res = append(res, ListRequest{ThreatType: parts[0], PlatformType: parts[1], ThreatEntryType: parts[2]})
+	}
+	return res, nil
+}
+
+// Track adds lists that are requested on every update, including the first one before anything is stored
+func (l *List) Track(lists []ListRequest) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tracked = append(l.tracked, lists...)
+}
+
+// Open loads the snapshot at path. A missing file yields an empty list, an empty path keeps it in memory only.
+func Open(path string) (*List, error) {
+	l := &List{path: path, lists: make(map[string]*threatList)}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload rereads the snapshot file, keeping the current lists if it can't be applied
+func (l *List) Reload() error {
+	if l.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	lists, err := apply(nil, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%s: %w", l.path, err)
+	}
+
+	l.mu.Lock()
+	l.lists = lists
+	l.mu.Unlock()
+	return nil
+}
+
+// Update fetches changes for the stored and tracked lists from src, applies them and saves the snapshot
+func (l *List) Update(ctx context.Context, src Source) error {
+	l.mu.RLock()
+	current := l.lists
+	var req []ListRequest
+	for _, t := range current {
+		req = append(req, ListRequest{
+			ThreatType:      t.ThreatType,
+			PlatformType:    t.PlatformType,
+			ThreatEntryType: t.ThreatEntryType,
+			State:           t.State,
+		})
+	}
+	for _, t := range l.tracked {
+		if _, ok := current[t.key()]; !ok {
+			req = append(req, t)
+		}
+	}
+	l.mu.RUnlock()
+
+	body, err := src.Fetch(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	lists, err := apply(current, body)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.lists = lists
+	l.mu.Unlock()
+
+	return l.save(lists)
+}
+
+// Check reports whether any host suffix/path prefix expression of rawURL matches a stored prefix,
+// returning the threat type of the matching list
+func (l *List) Check(rawURL string) (string, bool) {
+	if l == nil {
+		return "", false
+	}
+
+	full := hashes(rawURL)
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, t := range l.lists {
+		for _, h := range full {
+			if t.contains(h[:]) {
+				return t.ThreatType, true
+			}
+		}
+	}
+	return "", false
+}
+
+// contains reports whether a stored prefix is a prefix of the full hash
+func (l *threatList) contains(hash []byte) bool {
+	for _, size := range l.sizes {
+		prefix := string(hash[:size])
+		if i := sort.SearchStrings(l.prefixes, prefix); i < len(l.prefixes) && l.prefixes[i] == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// apply reads an update and returns the lists resulting from applying it to current. A list update
+// leading to the state a list already has is skipped, so that an update file read again leaves it alone.
+func apply(current map[string]*threatList, r io.Reader) (map[string]*threatList, error) {
+	var res UpdateResponse
+	if err := json.NewDecoder(r).Decode(&res); err != nil {
+		return nil, err
+	}
+
+	lists := make(map[string]*threatList, len(current))
+	for k, v := range current {
+		lists[k] = v
+	}
+
+	for _, u := range res.ListUpdateResponses {
+		t := &threatList{
+			ThreatType:      u.ThreatType,
+			PlatformType:    u.PlatformType,
+			ThreatEntryType: u.ThreatEntryType,
+			State:           u.NewClientState,
+		}
+
+		old, ok := lists[t.key()]
+		if ok && old.State != "" && old.State == u.NewClientState {
+			continue
+		}
+
+		var prefixes []string
+		if ok && u.ResponseType != FullUpdate {
+			prefixes = old.prefixes
+		}
+
+		prefixes, err := remove(prefixes, u.Removals)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, set := range u.Additions {
+			if set.CompressionType != "" && set.CompressionType != compressionRaw || set.RawHashes == nil {
+				return nil, ErrorUnsupported
+			}
+
+			size, raw := set.RawHashes.PrefixSize, set.RawHashes.RawHashes
+			if size < 4 || size > sha256.Size || len(raw)%size != 0 {
+				return nil, ErrorUnsupported
+			}
+			for i := 0; i < len(raw); i += size {
+				prefixes = append(prefixes, string(raw[i:i+size]))
+			}
+		}
+
+		slices.Sort(prefixes)
+		t.prefixes = slices.Compact(prefixes)
+		for _, p := range t.prefixes {
+			if !slices.Contains(t.sizes, len(p)) {
+				t.sizes = append(t.sizes, len(p))
+			}
+		}
+
+		if u.Checksum != nil {
+			sum := sha256.Sum256([]byte(strings.Join(t.prefixes, "")))
+			if !bytes.Equal(sum[:], u.Checksum.SHA256) {
+				return nil, fmt.Errorf("%s: %w", t.key(), ErrorChecksum)
+			}
+		}
+
+		lists[t.key()] = t
+	}
+	return lists, nil
+}
+
+// remove drops the prefixes at the given indices of the sorted list
+func remove(prefixes []string, sets []ThreatEntrySet) ([]string, error) {
+	drop := make(map[int]bool)
+	for _, set := range sets {
+		if set.CompressionType != "" && set.CompressionType != compressionRaw || set.RawIndices == nil {
+			return nil, ErrorUnsupported
+		}
+		for _, i := range set.RawIndices.Indices {
+			if i < 0 || i >= len(prefixes) {
+				return nil, ErrorIndex
+			}
+			drop[i] = true
+		}
+	}
+
+	res := make([]string, 0, len(prefixes))
+	for i, p := range prefixes {
+		if !drop[i] {
+			res = append(res, p)
+		}
+	}
+	return res, nil
+}
+
+// save writes the lists to the snapshot file as a full update
+func (l *List) save(lists map[string]*threatList) error {
+	if l.path == "" {
+		return nil
+	}
+
+	var snapshot UpdateResponse
+	for _, t := range lists {
+		u := ListUpdate{
+			ThreatType:      t.ThreatType,
+			PlatformType:    t.PlatformType,
+			ThreatEntryType: t.ThreatEntryType,
+			ResponseType:    FullUpdate,
+			NewClientState:  t.State,
+		}
+
+		bySize := make(map[int][]byte)
+		for _, p := range t.prefixes {
+			bySize[len(p)] = append(bySize[len(p)], p...)
+		}
+		for size, raw := range bySize {
+			u.Additions = append(u.Additions, ThreatEntrySet{
+				CompressionType: compressionRaw,
+				RawHashes:       &RawHashes{PrefixSize: size, RawHashes: raw},
+			})
+		}
+		snapshot.ListUpdateResponses = append(snapshot.ListUpdateResponses, u)
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
@@ -0,0 +1,65 @@
+package threatlist
+
+// Response types of a list update
+const (
+	FullUpdate    = "FULL_UPDATE"
+	PartialUpdate = "PARTIAL_UPDATE"
+)
+
+// compressionRaw is the only supported encoding of additions and removals
+const compressionRaw = "RAW"
+
+// UpdateResponse is a threatListUpdates:fetch response in the Safe Browsing v4 JSON format.
+// The same format is used for the snapshot stored on disk.
+type UpdateResponse struct {
+	ListUpdateResponses []ListUpdate `json:"listUpdateResponses"`
+	MinimumWaitDuration string       `json:"minimumWaitDuration,omitempty"`
+}
+
+// ListUpdate holds the changes of a single threat list
+type ListUpdate struct {
+	ThreatType      string           `json:"threatType"`
+	PlatformType    string           `json:"platformType"`
+	ThreatEntryType string           `json:"threatEntryType"`
+	ResponseType    string           `json:"responseType"`
+	Additions       []ThreatEntrySet `json:"additions,omitempty"`
+	Removals        []ThreatEntrySet `json:"removals,omitempty"`
+	NewClientState  string           `json:"newClientState,omitempty"`
+	Checksum        *Checksum        `json:"checksum,omitempty"`
+}
+
+// ThreatEntrySet holds added hash prefixes or removed indices, only RAW compression is supported
+type ThreatEntrySet struct {
+	CompressionType string      `json:"compressionType,omitempty"`
+	RawHashes       *RawHashes  `json:"rawHashes,omitempty"`
+	RawIndices      *RawIndices `json:"rawIndices,omitempty"`
+}
+
+// RawHashes holds concatenated hash prefixes of the same size
+type RawHashes struct {
+	PrefixSize int    `json:"prefixSize"`
+	RawHashes  []byte `json:"rawHashes"`
+}
+
+// RawIndices holds indices into the lexicographically sorted prefixes of a list
+type RawIndices struct {
+	Indices []int `json:"indices"`
+}
+
+// Checksum is the SHA256 of all prefixes of a list after the update, sorted and concatenated
+type Checksum struct {
+	SHA256 []byte `json:"sha256"`
+}
+
+// ListRequest describes the stored state of a list sent to the update source
+type ListRequest struct {
+	ThreatType      string `json:"threatType"`
+	PlatformType    string `json:"platformType"`
+	ThreatEntryType string `json:"threatEntryType"`
+	State           string `json:"state,omitempty"`
+}
+
+// key identifies the requested list by its descriptor
+func (r ListRequest) key() string {
+	return r.ThreatType + "/" + r.PlatformType + "/" + r.ThreatEntryType
+}
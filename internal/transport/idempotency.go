@@ -0,0 +1,155 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"url-shortener/internal/handler"
+	"url-shortener/internal/idempotency"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxIdempotencyKey bounds the length of an Idempotency-Key header
+const maxIdempotencyKey = 255
+
+// replayedHeaders are the response headers stored and replayed with an idempotent response
+var replayedHeaders = []string{"Content-Type", "Location", "Content-Disposition"}
+
+// recordingWriter copies what is written to the response so that it can be stored,
+// giving up once the response grows over limit since it won't be stored then
+type recordingWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+// record copies data unless the response is already over the limit
+func (w *recordingWriter) record(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(data) > w.limit {
+		w.overflow = true
+		w.body = bytes.Buffer{}
+		return
+	}
+	w.body.Write(data)
+}
+
+// Write implements io.Writer interface for recordingWriter
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.record(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString implements io.StringWriter interface for recordingWriter
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Unwrap returns the wrapped writer so that http.ResponseController can reach the connection
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// WithIdempotency adds middleware replaying the stored response of requests retried by the same user with the same
+// Idempotency-Key, method, URL and body. A key reused with a different request is rejected with 422.
+// Responses with 5xx statuses or bodies over the store's limit aren't stored so that such requests can be retried.
+// Keys are refused on streamed NDJSON batches, which would have to be buffered whole to be fingerprinted and replayed.
+func (t *Transport) WithIdempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			handler.Fail(c, http.StatusBadRequest, "Idempotency-Key is too long!", nil)
+			c.Abort()
+			return
+		}
+		if handler.Streamed(c.GetHeader("Content-Type")) {
+			handler.Fail(c, http.StatusBadRequest, "Idempotency-Key can't be used with streamed batches!", idempotency.ErrorUnsupported)
+			c.Abort()
+			return
+		}
+
+		body, ok := handler.ReadBody(c, "Error reading body!")
+		if !ok {
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		storeKey := c.GetString("user_id") + "\x00" + key
+		res, err := t.idempotency.Begin(storeKey, fingerprint(c.Request.Method, c.Request.URL.RequestURI(), c.ContentType(), body))
+		switch {
+		case errors.Is(err, idempotency.ErrorMismatch):
+			handler.Fail(c, http.StatusUnprocessableEntity, "Idempotency-Key was used for a different request!", err)
+			c.Abort()
+			return
+		case errors.Is(err, idempotency.ErrorInProgress):
+			handler.Fail(c, http.StatusConflict, "Request with this Idempotency-Key is in progress!", err)
+			c.Abort()
+			return
+		case errors.Is(err, idempotency.ErrorFull):
+			c.Header("Retry-After", "1")
+			handler.Fail(c, http.StatusServiceUnavailable, "Too many requests with an Idempotency-Key are in progress!", err)
+			c.Abort()
+			return
+		case res != nil:
+			for name, values := range res.Header {
+				c.Writer.Header()[name] = values
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.Status(res.Status)
+			c.Writer.Write(res.Body)
+			c.Abort()
+			return
+		}
+
+		finished := false
+		defer func() {
+			if !finished {
+				t.idempotency.Release(storeKey)
+			}
+		}()
+
+		w := &recordingWriter{ResponseWriter: c.Writer, limit: t.idempotency.MaxBody()}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.Status() >= http.StatusInternalServerError || w.overflow {
+			return
+		}
+
+		header := make(http.Header)
+		for _, name := range replayedHeaders {
+			if values := w.Header().Values(name); len(values) > 0 {
+				header[name] = values
+			}
+		}
+		t.idempotency.Finish(storeKey, idempotency.Response{Status: w.Status(), Header: header, Body: w.body.Bytes()})
+		finished = true
+	}
+}
+
+// fingerprint identifies a request by its method, URL, content type and body
+func fingerprint(method, uri, contentType string, body []byte) [32]byte {
+	h := sha256.New()
+	for _, part := range []string{method, uri, contentType} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+
+	var sum [32]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
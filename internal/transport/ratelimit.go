@@ -0,0 +1,71 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"url-shortener/internal/handler"
+	"url-shortener/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetRateLimitStore replaces the in-memory rate limit buckets, e.g. with a store shared by all instances
+func (t *Transport) SetRateLimitStore(store ratelimit.Store) {
+	t.limiter = store
+}
+
+// WithRateLimit adds middleware limiting the requests of each client to the routes of a class with a token bucket.
+// Clients are told apart by a configured X-API-Key, otherwise by their IP address.
+// Every response carries RateLimit-* headers, requests over the limit get 429 with Retry-After.
+func (t *Transport) WithRateLimit(class, spec string) gin.HandlerFunc {
+	limit, err := ratelimit.Parse(spec)
+	if err != nil {
+		t.log.Error("invalid rate limit, requests aren't limited", "class", class, "limit", spec, "error", err)
+	}
+	if !limit.Enabled() {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	return func(c *gin.Context) {
+		res, err := t.limiter.Take(c.Request.Context(), class+"\x00"+t.rateKey(c), limit)
+		if err != nil {
+			t.log.Error("failed to check rate limit", "class", class, "error", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", ceilSeconds(res.Reset))
+		if !res.Allowed {
+			c.Header("Retry-After", ceilSeconds(res.RetryAfter))
+			handler.Fail(c, http.StatusTooManyRequests, "Too many requests!", nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateKey identifies the client of a request: an API key listed in RATE_LIMIT_KEYS, then the client IP.
+// Other API keys and user IDs don't tell clients apart, since any request without a cookie is handed
+// a new user ID and clients could otherwise get a fresh bucket for every request.
+func (t *Transport) rateKey(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		if sum := sha256.Sum256([]byte(key)); t.apiKeys[sum] {
+			return "key:" + hex.EncodeToString(sum[:16])
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// ceilSeconds formats a duration as a whole number of seconds, rounded up
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -1,28 +1,39 @@
 package transport
 
 import (
-	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"url-shortener/internal/config"
 	"url-shortener/internal/handler"
+	"url-shortener/internal/idempotency"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/ratelimit"
+	"url-shortener/internal/redirect"
+	"url-shortener/internal/tracing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 // Transport handles HTTP transport layer operations including middleware and routing
 type Transport struct {
-	handler *handler.Handler
-	log     *slog.Logger
-	cfg     config.Config
+	handler     *handler.Handler
+	log         *slog.Logger
+	cfg         config.Config
+	idempotency *idempotency.Store
+	limiter     ratelimit.Store
+	apiKeys     map[[32]byte]bool
 }
 
 // Claims represents JWT claims structure with user identification
@@ -31,23 +42,99 @@ type Claims struct {
 	UserID string
 }
 
-// gzipWriter wraps gin.ResponseWriter to provide gzip compression
+// gzipWriter wraps gin.ResponseWriter to provide gzip compression.
+// Compression is enabled on the first write once the response Content-Type is known.
 type gzipWriter struct {
 	gin.ResponseWriter
-	gzip *gzip.Writer
+	gzip    *gzip.Writer
+	decided bool
 }
 
 // Write implements io.Writer interface for gzipWriter
-func (gz gzipWriter) Write(data []byte) (int, error) {
+func (gz *gzipWriter) Write(data []byte) (int, error) {
+	if !gz.decided {
+		gz.decided = true
+		if compressible(gz.Header().Get("Content-Type")) {
+			gz.Header().Set("Content-Encoding", "gzip")
+			gz.Header().Del("Content-Length")
+			gz.gzip = gzip.NewWriter(gz.ResponseWriter)
+		}
+	}
+
+	if gz.gzip == nil {
+		return gz.ResponseWriter.Write(data)
+	}
 	return gz.gzip.Write(data)
 }
 
+// WriteString implements io.StringWriter interface for gzipWriter
+func (gz *gzipWriter) WriteString(s string) (int, error) {
+	return gz.Write([]byte(s))
+}
+
+// Flush sends any buffered compressed data to the client
+func (gz *gzipWriter) Flush() {
+	if gz.gzip != nil {
+		gz.gzip.Flush()
+	}
+	gz.ResponseWriter.Flush()
+}
+
+// Unwrap returns the wrapped writer so that http.ResponseController can reach the connection
+func (gz *gzipWriter) Unwrap() http.ResponseWriter {
+	return gz.ResponseWriter
+}
+
+// Close finishes the gzip stream if compression was enabled
+func (gz *gzipWriter) Close() error {
+	if gz.gzip == nil {
+		return nil
+	}
+	return gz.gzip.Close()
+}
+
+// gzipBody inflates a gzip encoded request body as it is read
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+// Close closes both the gzip reader and the original body
+func (b gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// compressible reports whether responses of the given content type are gzip encoded
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	switch mediaType {
+	case "application/json", handler.ProblemContentType, "text/html", "text/csv", "application/x-ndjson":
+		return true
+	}
+	return false
+}
+
 // New creates a new Transport instance with the provided configuration and handlers
 func New(cfg config.Config, h *handler.Handler, log *slog.Logger) *Transport {
+	ttl := cfg.IdempotencyTTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+
+	apiKeys := make(map[[32]byte]bool)
+	for _, key := range cfg.LimitKeys() {
+		apiKeys[sha256.Sum256([]byte(key))] = true
+	}
+
 	return &Transport{
-		handler: h,
-		log:     log,
-		cfg:     cfg,
+		handler:     h,
+		log:         log,
+		cfg:         cfg,
+		idempotency: idempotency.New(ttl),
+		limiter:     ratelimit.NewMemory(),
+		apiKeys:     apiKeys,
 	}
 }
 
@@ -55,38 +142,102 @@ func New(cfg config.Config, h *handler.Handler, log *slog.Logger) *Transport {
 func NewRouter(t *Transport) *gin.Engine {
 
 	r := gin.Default()
+	if err := r.SetTrustedProxies(t.cfg.Proxies()); err != nil {
+		t.log.Error("invalid trusted proxies", "error", err)
+	}
 
+	r.Use(t.WithTracing())
 	r.Use(t.WithLogging(t.log))
+	r.Use(t.WithMetrics())
+	r.Use(t.WithProblems())
+	r.Use(t.WithBodyLimit())
 	r.Use(t.WithDecodingReq())
 	r.Use(t.WithEncodingRes())
 	r.Use(t.WithCookies())
+	r.Use(t.WithDomain())
+	r.Use(t.WithUnfurlers())
+
+	create := t.WithRateLimit("create", t.cfg.RateLimitCreate)
+	remove := t.WithRateLimit("delete", t.cfg.RateLimitDelete)
 
-	r.POST("/", func(c *gin.Context) {
+	r.POST("/", create, t.WithIdempotency(), func(c *gin.Context) {
 		t.handler.PostURL(c, t.cfg)
 	})
-	r.POST("/api/shorten", func(c *gin.Context) {
+	r.GET("/:id", t.WithRateLimit("redirect", t.cfg.RateLimitRedirect), t.handler.GetURL)
+	r.GET("/:id/qr", func(c *gin.Context) {
+		t.handler.GetQR(c, t.cfg)
+	})
+	r.GET("/ping", t.handler.PingDB)
+
+	// the versioned API answers errors with RFC 7807 problems, the unversioned routes are kept as aliases
+	t.apiRoutes(r.Group("/api"), create, remove)
+	t.apiRoutes(r.Group("/api/v1"), create, remove)
+
+	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+	r.NoRoute(func(c *gin.Context) {
+		if c.GetBool("problem") {
+			handler.Fail(c, http.StatusNotFound, "Route not found!", nil)
+		}
+	})
+
+	return r
+}
+
+// apiRoutes registers the JSON API on a route group, limiting link creation and deletion with the given middlewares
+func (t *Transport) apiRoutes(g *gin.RouterGroup, create, remove gin.HandlerFunc) {
+	g.POST("/shorten", create, t.WithIdempotency(), func(c *gin.Context) {
 		t.handler.ShortenURL(c, t.cfg)
 	})
-	r.POST("/api/shorten/batch", func(c *gin.Context) {
+	g.POST("/shorten/batch", create, t.WithIdempotency(), func(c *gin.Context) {
 		t.handler.ShortenBatch(c, t.cfg)
 	})
 
-	r.GET("/:id", t.handler.GetURL)
-	r.GET("/ping", t.handler.PingDB)
-	r.GET("/api/user/urls", func(c *gin.Context) {
+	g.GET("/user/urls", func(c *gin.Context) {
 		t.handler.GetUserURLs(c, t.cfg)
 	})
-	r.GET("/api/internal/stats", func(c *gin.Context) {
+	g.GET("/user/urls/:id/qr", func(c *gin.Context) {
+		t.handler.GetUserQR(c, t.cfg)
+	})
+	g.GET("/user/urls/:id/stats", func(c *gin.Context) {
+		t.handler.GetClickStats(c, t.cfg)
+	})
+	g.GET("/internal/stats", func(c *gin.Context) {
 		t.handler.GetStats(c, t.cfg)
 	})
 
-	r.DELETE("/api/user/urls", func(c *gin.Context) {
-		t.handler.DeleteURLs(c, t.cfg)
+	g.POST("/internal/blocklist", func(c *gin.Context) {
+		t.handler.BlockURL(c, t.cfg)
 	})
 
-	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	g.GET("/user/urls/export", func(c *gin.Context) {
+		t.handler.ExportURLs(c, t.cfg)
+	})
+	g.POST("/user/urls/import", create, func(c *gin.Context) {
+		t.handler.ImportURLs(c, t.cfg)
+	})
 
-	return r
+	g.PATCH("/user/urls/:id", func(c *gin.Context) {
+		t.handler.UpdateURL(c, t.cfg)
+	})
+
+	g.PUT("/user/domain", func(c *gin.Context) {
+		t.handler.SetDefaultDomain(c, t.cfg)
+	})
+
+	g.DELETE("/user/urls", remove, func(c *gin.Context) {
+		t.handler.DeleteURLs(c, t.cfg)
+	})
+}
+
+// WithProblems adds middleware marking requests to the versioned API, whose errors are written as RFC 7807 problems
+func (t *Transport) WithProblems() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, "/api/v1/") {
+			c.Set("problem", true)
+		}
+		c.Next()
+	}
 }
 
 // WithLogging adds request logging middleware that records URI, method, duration, status, and size.
@@ -113,6 +264,47 @@ func (t *Transport) WithLogging(log *slog.Logger) gin.HandlerFunc {
 	}
 }
 
+// WithMetrics adds middleware counting requests and their latency by method, route pattern and status.
+func (t *Transport) WithMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.Requests.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.RequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// WithTracing adds middleware starting a server span for every request, continuing the W3C trace context
+// of the incoming traceparent header so the spans of services and storage queries join the caller's trace
+func (t *Transport) WithTracing() gin.HandlerFunc {
+	return otelgin.Middleware(tracing.ServiceName)
+}
+
+// WithBodyLimit adds middleware limiting the size of request bodies as sent. Bodies declared larger are
+// rejected with 413 right away, others fail to read once they exceed the limit.
+func (t *Transport) WithBodyLimit() gin.HandlerFunc {
+	limit := t.cfg.MaxBodyBytes
+	if limit <= 0 {
+		limit = config.DefaultMaxBodyBytes
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			handler.Fail(c, http.StatusRequestEntityTooLarge, "Request body is too large!", nil)
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
 // WithDecodingReq adds middleware to handle gzip-encoded request bodies.
 func (t *Transport) WithDecodingReq() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -132,15 +324,13 @@ func (t *Transport) WithDecodingReq() gin.HandlerFunc {
 		}
 		defer r.Close()
 
-		newBody, err := io.ReadAll(r)
-		if err != nil {
-			slog.Error("failed to read gzipped body",
-				"error", err,
-				"path", c.Request.URL.Path)
-			c.Next()
-			return
+		// the body is inflated as handlers read it, up to the decompressed size limit
+		limit := t.cfg.MaxDecompressedBytes
+		if limit <= 0 {
+			limit = config.DefaultMaxDecompressedBytes
 		}
-		c.Request.Body = io.NopCloser(bytes.NewReader(newBody))
+		c.Request.Body = http.MaxBytesReader(c.Writer, gzipBody{Reader: r, body: c.Request.Body}, limit)
+		c.Request.ContentLength = -1
 		c.Next()
 	}
 }
@@ -149,23 +339,15 @@ func (t *Transport) WithDecodingReq() gin.HandlerFunc {
 func (t *Transport) WithEncodingRes() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		header := c.Request.Header.Get("Accept-Encoding")
-		if header != "gzip" {
+		if !strings.Contains(header, "gzip") {
 			c.Next()
 			return
 		}
 
-		header = c.Writer.Header().Get("Content-Type")
-		if header == "application/json" || header == "text/html" {
-			gz := gzip.NewWriter(c.Writer)
-			defer gz.Close()
-
-			c.Header("Content-Encoding", "gzip")
+		gz := &gzipWriter{ResponseWriter: c.Writer}
+		defer gz.Close()
 
-			c.Writer = gzipWriter{
-				ResponseWriter: c.Writer,
-				gzip:           gz,
-			}
-		}
+		c.Writer = gz
 		c.Next()
 	}
 }
@@ -178,7 +360,7 @@ func (t *Transport) WithCookies() gin.HandlerFunc {
 			claims := &Claims{}
 			token, err := jwt.ParseWithClaims(cookie, claims, func(t *jwt.Token) (interface{}, error) {
 				if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-					c.String(http.StatusBadRequest, "Unexpected signing method!")
+					handler.Fail(c, http.StatusBadRequest, "Unexpected signing method!", nil)
 					return nil, err
 				}
 				return []byte("123"), nil
@@ -186,12 +368,13 @@ func (t *Transport) WithCookies() gin.HandlerFunc {
 
 			if err != nil {
 				if claims.UserID == "" {
-					c.String(http.StatusUnauthorized, "User ID not found!")
+					handler.Fail(c, http.StatusUnauthorized, "User ID not found!", nil)
 					return
 				}
 			} else if token.Valid {
 				UserID = claims.UserID
 				c.Set("user_id", UserID)
+				c.Set("authenticated", true)
 				c.Next()
 				return
 			}
@@ -220,3 +403,20 @@ func (t *Transport) WithCookies() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// WithDomain adds middleware resolving the branded short domain serving the request Host.
+func (t *Transport) WithDomain() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("domain", t.cfg.DomainOf(c.Request.Host))
+		c.Next()
+	}
+}
+
+// WithUnfurlers adds middleware flagging requests from link unfurling bots such as Slackbot or Twitterbot.
+func (t *Transport) WithUnfurlers() gin.HandlerFunc {
+	agents := t.cfg.Unfurlers(redirect.DefaultUnfurlers)
+	return func(c *gin.Context) {
+		c.Set("unfurler", redirect.IsUnfurler(c.Request.UserAgent(), agents))
+		c.Next()
+	}
+}
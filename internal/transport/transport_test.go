@@ -0,0 +1,286 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+	"url-shortener/internal/config"
+	"url-shortener/internal/handler"
+	"url-shortener/internal/idempotency"
+	"url-shortener/internal/logger"
+	"url-shortener/internal/models"
+	"url-shortener/internal/ratelimit"
+	"url-shortener/internal/services"
+	"url-shortener/internal/storage"
+
+	"github.com/brianvoe/gofakeit/v7"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupTest builds a router over a fresh file storage
+func setupTest(t *testing.T, cfg config.Config) (*Transport, *gin.Engine) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg.BaseURL = "http://localhost:8080"
+	cfg.StoragePath = filepath.Join(t.TempDir(), "storage.json")
+
+	log := logger.New()
+	store, err := storage.New(context.Background(), &cfg)
+	require.NoError(t, err)
+
+	tr := New(cfg, handler.New(services.New(context.Background(), log, store), log), log)
+	return tr, NewRouter(tr)
+}
+
+// userCookie returns a JWT cookie authenticating userID
+func userCookie(t *testing.T, userID string) *http.Cookie {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		UserID:           userID,
+	})
+	signed, err := token.SignedString([]byte("123"))
+	require.NoError(t, err)
+	return &http.Cookie{Name: "jwt", Value: signed}
+}
+
+func TestIdempotency(t *testing.T) {
+	tr, r := setupTest(t, config.Config{})
+	userID := gofakeit.UUID()
+	cookie := userCookie(t, userID)
+
+	shorten := func(key, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/shorten", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Idempotency-Key", key)
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	body := func(url string) string {
+		b, _ := json.Marshal(models.ShortenURLRequest{URL: url})
+		return string(b)
+	}
+
+	// a retry gets the stored response
+	first := body(gofakeit.URL())
+	w := shorten("replay", "application/json", first)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+
+	retry := shorten("replay", "application/json", first)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, w.Body.String(), retry.Body.String())
+	assert.Equal(t, w.Header().Get("Content-Type"), retry.Header().Get("Content-Type"))
+
+	// the key can't be reused for another request
+	w = shorten("replay", "application/json", body(gofakeit.URL()))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "idempotency_key_reused")
+
+	// a retry while the first request runs is refused
+	second := body(gofakeit.URL())
+	uri := "/api/v1/shorten"
+	_, err := tr.idempotency.Begin(userID+"\x00running", fingerprint("POST", uri, "application/json", []byte(second)))
+	require.NoError(t, err)
+	w = shorten("running", "application/json", second)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "idempotency_key_in_progress")
+
+	// streamed batches don't take keys
+	req := httptest.NewRequest("POST", "/api/v1/shorten/batch", bytes.NewBufferString(`{"correlation_id":"1","original_url":"`+gofakeit.URL()+`"}`+"\n"))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Idempotency-Key", "stream")
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "idempotency_key_unsupported")
+
+	// responses over the body limit aren't replayed
+	tr.idempotency = idempotency.NewLimited(time.Hour, 10, 1<<20, 16)
+	large := body(gofakeit.URL())
+	w = shorten("large", "application/json", large)
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = shorten("large", "application/json", large)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+	n, size := tr.idempotency.Len()
+	assert.Zero(t, n)
+	assert.Zero(t, size)
+
+	// keys expire after the TTL
+	tr.idempotency = idempotency.New(50 * time.Millisecond)
+	w = shorten("expiring", "application/json", body(gofakeit.URL()))
+	require.Equal(t, http.StatusCreated, w.Code)
+	time.Sleep(100 * time.Millisecond)
+	w = shorten("expiring", "application/json", body(gofakeit.URL()))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+}
+
+func TestIdempotencyLimits(t *testing.T) {
+	store := idempotency.NewLimited(time.Hour, 2, 100, 60)
+	fp := [32]byte{1}
+	finish := func(key string, size int) {
+		res, err := store.Begin(key, fp)
+		require.NoError(t, err)
+		require.Nil(t, res)
+		store.Finish(key, idempotency.Response{Status: http.StatusCreated, Body: make([]byte, size)})
+	}
+
+	// the oldest response is dropped for a new key once the store holds maxEntries keys
+	finish("a", 10)
+	finish("b", 10)
+	finish("c", 10)
+	n, size := store.Len()
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 20, size)
+	res, err := store.Begin("a", fp)
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+	store.Release("a")
+
+	// and once the bodies would go over maxBytes
+	finish("d", 60)
+	n, size = store.Len()
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 70, size)
+	finish("e", 50)
+	n, size = store.Len()
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 50, size)
+	res, err = store.Begin("e", fp)
+	require.NoError(t, err)
+	require.NotNil(t, res)
+	assert.Len(t, res.Body, 50)
+
+	// requests in progress are never dropped
+	store = idempotency.NewLimited(time.Hour, 2, 100, 60)
+	_, err = store.Begin("x", fp)
+	require.NoError(t, err)
+	_, err = store.Begin("y", fp)
+	require.NoError(t, err)
+	_, err = store.Begin("z", fp)
+	assert.ErrorIs(t, err, idempotency.ErrorFull)
+	_, err = store.Begin("x", fp)
+	assert.ErrorIs(t, err, idempotency.ErrorInProgress)
+}
+
+func TestRateLimitMemory(t *testing.T) {
+	_, err := ratelimit.Parse("10/minute")
+	assert.ErrorIs(t, err, ratelimit.ErrorLimit)
+	limit, err := ratelimit.Parse("2/200ms")
+	require.NoError(t, err)
+	assert.Equal(t, ratelimit.Limit{Rate: 10, Burst: 2}, limit)
+
+	ctx := context.Background()
+	m := ratelimit.NewMemory()
+	for i := 1; i >= 0; i-- {
+		res, err := m.Take(ctx, "a", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 2, res.Limit)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res, err := m.Take(ctx, "a", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.InDelta(t, 100*time.Millisecond, res.RetryAfter, float64(10*time.Millisecond))
+	assert.InDelta(t, 200*time.Millisecond, res.Reset, float64(10*time.Millisecond))
+
+	// other keys have their own buckets
+	res, err = m.Take(ctx, "b", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	time.Sleep(res.Reset)
+	res, err = m.Take(ctx, "a", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
+
+func TestRateLimit(t *testing.T) {
+	_, r := setupTest(t, config.Config{RateLimitCreate: "2/1m", RateLimitKeys: "partner-key, other-key"})
+
+	shorten := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/shorten", bytes.NewBufferString(`{"url":"`+gofakeit.URL()+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := shorten("")
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+
+	// unknown API keys don't get a bucket of their own
+	w = shorten(gofakeit.UUID())
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	w = shorten(gofakeit.UUID())
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", w.Header().Get("RateLimit-Reset"))
+	assert.Contains(t, w.Body.String(), "rate_limited")
+
+	// configured API keys do
+	w = shorten("partner-key")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	w = shorten("other-key")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+
+	// routes without a limit carry no headers
+	req := httptest.NewRequest("GET", "/ping", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimitFreshCookies(t *testing.T) {
+	_, r := setupTest(t, config.Config{RateLimitCreate: "2/1m"})
+
+	// a client fetching a new cookie before each request, or signing its own, still runs out of tokens
+	codes := make([]int, 0, 4)
+	for i := 0; i < 4; i++ {
+		ping := httptest.NewRecorder()
+		r.ServeHTTP(ping, httptest.NewRequest("GET", "/ping", nil))
+		cookies := ping.Result().Cookies()
+		require.NotEmpty(t, cookies)
+
+		req := httptest.NewRequest("POST", "/api/v1/shorten", bytes.NewBufferString(`{"url":"`+gofakeit.URL()+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if i%2 == 0 {
+			req.AddCookie(cookies[0])
+		} else {
+			req.AddCookie(userCookie(t, gofakeit.UUID()))
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	assert.Equal(t, []int{http.StatusCreated, http.StatusCreated, http.StatusTooManyRequests, http.StatusTooManyRequests}, codes)
+}
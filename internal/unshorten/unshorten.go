@@ -0,0 +1,88 @@
+// Package unshorten expands links of known external URL shorteners one redirect at a time.
+package unshorten
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultHosts lists well-known public URL shorteners
+var DefaultHosts = []string{
+	"bit.ly", "bitly.com", "t.co", "tinyurl.com", "goo.gl", "ow.ly", "is.gd", "buff.ly",
+	"rebrand.ly", "cutt.ly", "shorturl.at", "tiny.cc", "rb.gy", "t.ly", "s.id", "lnkd.in",
+}
+
+// ErrorNoLocation is returned when a shortener answers a redirect without a usable Location
+var ErrorNoLocation = errors.New("shortener redirect without location")
+
+// Expander resolves links of the configured shortener hosts
+type Expander struct {
+	client *http.Client
+	hosts  map[string]bool
+}
+
+// New creates an Expander for the given shortener hosts. The client's redirect policy is replaced
+// so that every hop is inspected; a client with a 5 second timeout is used if nil.
+func New(client *http.Client, hosts []string) *Expander {
+	c := &http.Client{Timeout: 5 * time.Second}
+	if client != nil {
+		copied := *client
+		c = &copied
+	}
+	c.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	e := &Expander{client: c, hosts: make(map[string]bool)}
+	for _, h := range hosts {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			e.hosts[h] = true
+		}
+	}
+	return e
+}
+
+// Expand returns the target of rawURL if it is a link of a known shortener, or rawURL unchanged otherwise
+func (e *Expander) Expand(ctx context.Context, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !e.hosts[strings.ToLower(u.Hostname())] {
+		return rawURL, nil
+	}
+
+	res, err := e.do(ctx, http.MethodHead, rawURL)
+	if err == nil && (res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented) {
+		res, err = e.do(ctx, http.MethodGet, rawURL)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if res.StatusCode < 300 || res.StatusCode >= 400 {
+		return rawURL, nil
+	}
+
+	loc, err := res.Location()
+	if err != nil {
+		return "", ErrorNoLocation
+	}
+	return loc.String(), nil
+}
+
+// do sends a single request without following redirects
+func (e *Expander) do(ctx context.Context, method, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	return res, nil
+}
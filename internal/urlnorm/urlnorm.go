@@ -0,0 +1,166 @@
+// Package urlnorm produces canonical forms of URLs used to detect duplicate links.
+package urlnorm
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Options control optional normalization steps
+type Options struct {
+	// StripTracking removes well-known click tracking parameters such as utm_* and fbclid
+	StripTracking bool
+}
+
+// trackingParams are query parameters added by ad networks and mailers that don't change the page
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"gbraid":  true,
+	"wbraid":  true,
+	"msclkid": true,
+	"yclid":   true,
+	"twclid":  true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_ga":     true,
+	"_gl":     true,
+}
+
+// defaultPorts maps schemes to the port implied when none is given
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Normalize returns the canonical form of raw: lowercase scheme and host, no default
+// port, normalized percent-encoding, resolved dot segments, no trailing slash and
+// query parameters sorted by name. The fragment is kept as is.
+func Normalize(raw string, opts Options) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	host := strings.ToLower(u.Host)
+	if port := u.Port(); port != "" && defaultPorts[u.Scheme] == port {
+		host = strings.TrimSuffix(host, ":"+port)
+	}
+	u.Host = strings.TrimSuffix(host, ".")
+
+	p := normalizeEscapes(u.EscapedPath())
+	if p != "" {
+		p = path.Clean(p)
+	}
+	p = strings.TrimSuffix(p, "/")
+	if p == "." {
+		p = ""
+	}
+	u.RawPath = p
+	u.Path, err = url.PathUnescape(p)
+	if err != nil {
+		return "", err
+	}
+
+	u.RawQuery = normalizeQuery(u.RawQuery, opts)
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+// normalizeQuery normalizes each parameter's encoding, drops tracking parameters if
+// requested and sorts parameters by name keeping the order of repeated names
+func normalizeQuery(rawQuery string, opts Options) string {
+	type param struct {
+		key string
+		raw string
+	}
+
+	var params []param
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+		part = normalizeEscapes(part)
+
+		rawKey, _, _ := strings.Cut(part, "=")
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			key = rawKey
+		}
+
+		if opts.StripTracking && isTracking(key) {
+			continue
+		}
+		params = append(params, param{key: key, raw: part})
+	}
+
+	sort.SliceStable(params, func(i, j int) bool {
+		return params[i].key < params[j].key
+	})
+
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.raw
+	}
+	return strings.Join(parts, "&")
+}
+
+// isTracking reports whether a query parameter only carries click tracking data
+func isTracking(key string) bool {
+	key = strings.ToLower(key)
+	return strings.HasPrefix(key, "utm_") || trackingParams[key]
+}
+
+// normalizeEscapes decodes percent-encoded unreserved characters and uppercases the
+// hex digits of all remaining escapes
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteString(strings.ToUpper(s[i+1 : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+// isUnreserved reports whether c may appear unescaped anywhere in a URL (RFC 3986 section 2.3)
+func isUnreserved(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}